@@ -0,0 +1,42 @@
+package rss2telegram
+
+import (
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/mmcdole/gofeed/atom"
+)
+
+// authorsTranslator translates Atom feeds like gofeed.DefaultAtomTranslator, keeping the names
+// of all authors of entries in "authors" custom field of items separated by newlines,
+// as the default translator keeps the first author only.
+type authorsTranslator struct {
+	gofeed.DefaultAtomTranslator
+}
+
+// Translate translates Atom feed to gofeed.Feed.
+func (t *authorsTranslator) Translate(feed interface{}) (*gofeed.Feed, error) {
+	result, err := t.DefaultAtomTranslator.Translate(feed)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := feed.(*atom.Feed)
+	if !ok || len(f.Entries) != len(result.Items) {
+		return result, nil
+	}
+	for i, entry := range f.Entries {
+		if len(entry.Authors) < 2 {
+			continue
+		}
+		names := make([]string, 0, len(entry.Authors))
+		for _, author := range entry.Authors {
+			names = append(names, author.Name)
+		}
+		item := result.Items[i]
+		if item.Custom == nil {
+			item.Custom = map[string]string{}
+		}
+		item.Custom["authors"] = strings.Join(names, "\n")
+	}
+	return result, nil
+}
@@ -0,0 +1,51 @@
+package rss2telegram
+
+import "sync/atomic"
+
+// botPool is the pool of telegram bots messages are sent with in turn, each with its own token
+// and rate limiter, so the rate limits of telegram are spread across the bots.
+type botPool struct {
+	tokens   []string
+	limiters []*rateLimiter
+	// n is the number of bots taken from the pool.
+	n uint32
+}
+
+// newBotPool returns botPool of bots with tokens, each limited to ratePerSecond messages to all chats
+// and chatRatePerMinute messages to each chat. Returns nil for a single token.
+func newBotPool(tokens []string, ratePerSecond, chatRatePerMinute int) *botPool {
+	if len(tokens) < 2 {
+		return nil
+	}
+	p := &botPool{tokens: tokens}
+	for range tokens {
+		p.limiters = append(p.limiters, newRateLimiter(ratePerSecond, chatRatePerMinute))
+	}
+	return p
+}
+
+// next returns a copy of bot sending with the next bot of its pool in turn, or bot as is
+// if it has no pool. Each message of a multi-message item is sent by the same bot.
+func (bot telegramBot) next() telegramBot {
+	if bot.pool == nil {
+		return bot
+	}
+	i := int((atomic.AddUint32(&bot.pool.n, 1) - 1) % uint32(len(bot.pool.tokens)))
+	bot.apiToken = bot.pool.tokens[i]
+	bot.limiter = bot.pool.limiters[i]
+	return bot
+}
+
+// all returns the copies of bot sending with each bot of its pool, or bot alone if it has no pool.
+func (bot telegramBot) all() []telegramBot {
+	if bot.pool == nil {
+		return []telegramBot{bot}
+	}
+	bots := make([]telegramBot, len(bot.pool.tokens))
+	for i := range bots {
+		bots[i] = bot
+		bots[i].apiToken = bot.pool.tokens[i]
+		bots[i].limiter = bot.pool.limiters[i]
+	}
+	return bots
+}
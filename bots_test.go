@@ -0,0 +1,80 @@
+package rss2telegram
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBotPool(t *testing.T) {
+	now := time.Now()
+	tg := newTelegramServer(t)
+	feed := newFeedServer(t, "application/rss+xml", rssFeed(
+		[3]string{"One", "https://example.com/1", rfc1123(now.Add(-4 * time.Hour))},
+		[3]string{"Two", "https://example.com/2", rfc1123(now.Add(-3 * time.Hour))},
+		[3]string{"Three", "https://example.com/3", rfc1123(now.Add(-2 * time.Hour))},
+		[3]string{"Four", "https://example.com/4", rfc1123(now.Add(-time.Hour))},
+	))
+	cfg := testConfig(t, tg.URL, "1", feed.URL)
+	cfg.BotAPIToken = "first"
+	cfg.BotAPITokens = []string{"second"}
+	// items are sent one at a time, so the bots take turns in order
+	cfg.SendConcurrency = 1
+
+	if _, err := RunWithConfig(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	var tokens []string
+	for _, r := range tg.sent() {
+		tokens = append(tokens, r.Token)
+	}
+	if want := []string{"first", "second", "first", "second"}; !reflect.DeepEqual(tokens, want) {
+		t.Errorf("items sent with tokens %v, want %v", tokens, want)
+	}
+}
+
+func TestConfigFromEnvBotTokens(t *testing.T) {
+	t.Setenv("RSS_FEED_URL", "https://example.com/feed")
+	t.Setenv("TELEGRAM_CHAT_ID", "1")
+	t.Setenv("TELEGRAM_BOT_API_TOKEN", "first, second,third")
+
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.BotAPIToken != "first" || !reflect.DeepEqual(cfg.BotAPITokens, []string{"second", "third"}) {
+		t.Errorf("tokens = %q, %q, want first and the rest", cfg.BotAPIToken, cfg.BotAPITokens)
+	}
+}
+
+func TestBotPoolSingleToken(t *testing.T) {
+	if p := newBotPool([]string{"token"}, 30, 20); p != nil {
+		t.Errorf("newBotPool() of a single token = %v, want nil", p)
+	}
+}
+
+func TestCheckHealthBotPool(t *testing.T) {
+	tg := newTelegramServer(t)
+	tg.fail = func(r telegramRequest) int {
+		if r.Token == "revoked" {
+			return http.StatusUnauthorized
+		}
+		return 0
+	}
+	cfg := testConfig(t, tg.URL, "1", "https://example.com/feed")
+	cfg.BotAPIToken = "first"
+	cfg.BotAPITokens = []string{"revoked"}
+
+	if err := CheckHealth(context.Background(), cfg); err == nil {
+		t.Error("CheckHealth() succeeded, want the error of the revoked token")
+	}
+	var tokens []string
+	for _, r := range tg.sent() {
+		tokens = append(tokens, r.Token)
+	}
+	if want := []string{"first"}; !reflect.DeepEqual(tokens, want) {
+		t.Errorf("getMe succeeded with tokens %v, want %v", tokens, want)
+	}
+}
@@ -0,0 +1,107 @@
+package rss2telegram
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	// defaultCanonicalURLTimeout is the default timeout of fetching an article for its canonical url.
+	defaultCanonicalURLTimeout = 5 * time.Second
+	// maxCanonicalPageBytes is the maximum size of an article read looking for its canonical url,
+	// the canonical link is expected in the head of the page.
+	maxCanonicalPageBytes = 512 << 10
+)
+
+// canonicalURL fetches the article at link and returns the url of its <link rel="canonical">.
+// Returns link as is if the article fails to be fetched within opts.canonicalTimeout
+// or it has no canonical link.
+func canonicalURL(ctx context.Context, opts feedOptions, link string) string {
+	ctx, cancel := context.WithTimeout(ctx, orDuration(opts.canonicalTimeout, defaultCanonicalURLTimeout))
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return link
+	}
+	req.Header.Set("User-Agent", opts.userAgent)
+	req.Header.Set("Accept", "text/html")
+
+	resp, err := opts.client.Do(req)
+	if err != nil {
+		logger.Debug("fetching canonical url", "link", link, "error", err)
+		return link
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		return link
+	}
+
+	href := canonicalHref(io.LimitReader(resp.Body, maxCanonicalPageBytes))
+	if href == "" {
+		return link
+	}
+	// relative canonical links are resolved against the url the article was redirected to
+	u, err := resp.Request.URL.Parse(href)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return link
+	}
+	return u.String()
+}
+
+// canonicalHref returns the href of the first <link rel="canonical"> in the head of HTML page r,
+// empty if there is none.
+func canonicalHref(r io.Reader) string {
+	z := xhtml.NewTokenizer(r)
+	for {
+		switch z.Next() {
+		case xhtml.ErrorToken:
+			return ""
+		case xhtml.StartTagToken, xhtml.SelfClosingTagToken:
+			t := z.Token()
+			if t.DataAtom == atom.Body {
+				// the canonical link belongs to the head
+				return ""
+			}
+			if t.DataAtom != atom.Link {
+				continue
+			}
+			var rel, href string
+			for _, a := range t.Attr {
+				switch a.Key {
+				case "rel":
+					rel = a.Val
+				case "href":
+					href = a.Val
+				}
+			}
+			for _, r := range strings.Fields(rel) {
+				if strings.EqualFold(r, "canonical") && strings.TrimSpace(href) != "" {
+					return strings.TrimSpace(href)
+				}
+			}
+		}
+	}
+}
+
+// withCanonicalURL returns a copy of item linking to its canonical url if opts.resolveCanonical is set,
+// so the state of the feed is still keyed by the original link. Returns item as is otherwise.
+func withCanonicalURL(ctx context.Context, opts feedOptions, item *gofeed.Item) *gofeed.Item {
+	if !opts.resolveCanonical || item.Link == "" {
+		return item
+	}
+	if u, err := url.Parse(item.Link); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return item
+	}
+	canonical := *item
+	canonical.Link = canonicalURL(ctx, opts, item.Link)
+	return &canonical
+}
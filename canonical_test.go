@@ -0,0 +1,81 @@
+package rss2telegram
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestCanonicalURL(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/article", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><head><title>A</title><link rel="Canonical" href="/posts/a"></head><body></body></html>`)
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/article?utm_source=feed", http.StatusFound)
+	})
+	mux.HandleFunc("/none", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><head></head><body><link rel="canonical" href="/in-body"></body></html>`)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+		fmt.Fprint(w, `<link rel="canonical" href="/late">`)
+	})
+	mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{}`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	opts := feedOptions{client: srv.Client(), userAgent: defaultUserAgent, canonicalTimeout: 100 * time.Millisecond}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/article", srv.URL + "/posts/a"},
+		{"/redirect", srv.URL + "/posts/a"},
+		{"/none", srv.URL + "/none"},
+		{"/slow", srv.URL + "/slow"},
+		{"/json", srv.URL + "/json"},
+		{"/missing", srv.URL + "/missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := canonicalURL(context.Background(), opts, srv.URL+tt.path); got != tt.want {
+				t.Errorf("canonicalURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithCanonicalURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<head><link rel="canonical" href="https://example.com/a"></head>`)
+	}))
+	defer srv.Close()
+
+	item := &gofeed.Item{Title: "A", Link: srv.URL + "/a?ref=feed"}
+	opts := feedOptions{client: srv.Client(), resolveCanonical: true}
+
+	got := withCanonicalURL(context.Background(), opts, item)
+	if got.Link != "https://example.com/a" {
+		t.Errorf("link = %q, want the canonical url", got.Link)
+	}
+	if item.Link != srv.URL+"/a?ref=feed" {
+		t.Errorf("the link of the item is modified to %q", item.Link)
+	}
+
+	opts.resolveCanonical = false
+	if got := withCanonicalURL(context.Background(), opts, item); got != item {
+		t.Error("item is copied with the option off")
+	}
+}
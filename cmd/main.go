@@ -2,13 +2,49 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
+	"os"
 
 	"github.com/ishmulyan/rss2telegram"
 )
 
+// Exit codes of a run, so schedulers can tell some failed feeds from a broken run.
+const (
+	// exitFailure is the exit code of a run failed as a whole, e.g. invalid config or all the feeds failed.
+	exitFailure = 1
+	// exitPartial is the exit code of a run with some of the feeds or items failed.
+	exitPartial = 2
+)
+
 func main() {
-	if err := rss2telegram.RSS2Telegram(context.Background(), rss2telegram.PubSubMessage{}); err != nil {
+	prune := flag.Bool("prune-cursors", false, "delete the state of feeds not in RSS_FEED_URL instead of posting")
+	flag.Parse()
+
+	ctx := context.Background()
+	if *prune {
+		if err := rss2telegram.PruneStaleCursors(ctx, rss2telegram.PubSubMessage{}); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	cfg, err := rss2telegram.ConfigFromEnv()
+	if err != nil {
 		log.Fatal(err)
 	}
+
+	sum, err := rss2telegram.RunWithConfig(ctx, cfg)
+	log.Printf("fetched %d items, sent %d, filtered out %d, failed %d; %d feeds failed",
+		sum.ItemsFetched, sum.ItemsSent, sum.ItemsFiltered, sum.ItemsFailed, sum.FeedsFailed)
+	if sum.SuggestedPollInterval > 0 {
+		log.Printf("feeds suggest polling every %v", sum.SuggestedPollInterval)
+	}
+	switch {
+	case err != nil:
+		log.Print(err)
+		os.Exit(exitFailure)
+	case sum.FeedsFailed > 0 || sum.ItemsFailed > 0:
+		os.Exit(exitPartial)
+	}
 }
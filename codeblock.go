@@ -0,0 +1,37 @@
+package rss2telegram
+
+import (
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	md "github.com/Skarlso/html-to-markdown"
+)
+
+// codeRules are the rules of converters keeping the code as is, in fenced code blocks and inline code
+// telegram renders as monospace. The code of the default rules is escaped as markdown text,
+// which telegram renders with backslashes inside of code entities, and code blocks are tagged
+// with the language telegram markdown renders as the first line of the code.
+var codeRules = []md.Rule{
+	{
+		Filter: []string{"code"},
+		Replacement: func(content string, selec *goquery.Selection, opt *md.Options) *string {
+			code := strings.TrimSpace(selec.Text())
+			if code == "" {
+				return md.String("")
+			}
+			text := "`" + strings.Replace(code, "`", "'", -1) + "`"
+			return &text
+		},
+	},
+	{
+		Filter: []string{"pre"},
+		Replacement: func(content string, selec *goquery.Selection, opt *md.Options) *string {
+			code := strings.Trim(selec.Text(), "\n")
+			if strings.TrimSpace(code) == "" {
+				return md.String("")
+			}
+			text := "\n\n```\n" + strings.Replace(code, "```", "'''", -1) + "\n```\n\n"
+			return &text
+		},
+	},
+}
@@ -0,0 +1,57 @@
+package rss2telegram
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestRenderContentPreserveCode(t *testing.T) {
+	item := &gofeed.Item{Content: "<p>Run <code>go_test -v</code>:</p>" +
+		"<pre><code class=\"language-go\">func main() {\n\tfmt.Println(\"a*b_c\")\n}</code></pre><p>Done.</p>"}
+	tests := []struct {
+		name         string
+		parseMode    string
+		preserveCode bool
+		want         string
+	}{
+		{"markdown", parseModeMarkdown, true, "Run `go_test -v`:\n\n```\nfunc main() {\n\tfmt.Println(\"a*b_c\")\n}\n```\n\nDone."},
+		{"MarkdownV2", parseModeMarkdownV2, true, "Run `go_test -v`:\n\n```\nfunc main() {\n\tfmt.Println(\"a*b_c\")\n}\n```\n\nDone\\."},
+		{"markdown escaped", parseModeMarkdown, false, "Run `go\\_test -v`:\n\n```go\nfunc main() {\n\tfmt.Println(\"a*b_c\")\n}\n```\n\nDone."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := renderContent(messageOptions{parseMode: tt.parseMode, preserveCode: tt.preserveCode}, item)
+			if got != tt.want {
+				t.Errorf("renderContent() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderContentPreserveCodeDelimiters(t *testing.T) {
+	item := &gofeed.Item{Content: "<code>a`b</code><pre>x\n```\ny</pre><p><code> </code></p>"}
+	got := renderContent(messageOptions{parseMode: parseModeMarkdown, preserveCode: true}, item)
+	if want := "`a'b`\n\n```\nx\n'''\ny\n```"; got != want {
+		t.Errorf("renderContent() = %q, want %q", got, want)
+	}
+}
+
+func TestPreserveCodeBlocksConfig(t *testing.T) {
+	cfg := Config{FeedURLs: []string{"https://example.com/feed"}, BotAPIToken: "token", ChatIDs: []string{"1"}}
+	cfg.PreserveCodeBlocks = true
+	bot, _, err := cfg.settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item := &gofeed.Item{Title: "Release", Description: "<p>Install:</p><pre><code>go install example.com/cmd/some_tool@latest</code></pre>"}
+	text, err := renderMessage(bot.message, item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Install:\n\n```\ngo install example.com/cmd/some_tool@latest\n```"; !strings.Contains(text, want) {
+		t.Errorf("renderMessage() = %q, want the code block %q", text, want)
+	}
+}
@@ -0,0 +1,797 @@
+package rss2telegram
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+const (
+	// defaultHTTPTimeout is the default timeout of http requests.
+	defaultHTTPTimeout = 30 * time.Second
+	// defaultMaxRetries is the default number of retries of requests failed with transient errors.
+	defaultMaxRetries = 2
+	// defaultRetryBaseDelay is the default delay before the first retry of a failed request.
+	defaultRetryBaseDelay = time.Second
+	// defaultUserAgent is the default User-Agent header of feed requests.
+	defaultUserAgent = "rss2telegram (+https://github.com/ishmulyan/rss2telegram)"
+	// defaultMaxFeedBytes is the default maximum size of a feed response body.
+	defaultMaxFeedBytes = 10 << 20
+	// defaultConcurrency is the default number of items sent at a time.
+	defaultConcurrency = 1
+	// defaultDateFormat is the default layout of the published time when only time zone is set.
+	defaultDateFormat = "2006-01-02 15:04 MST"
+	// titlePrefixAuto is the value of StripTitlePrefix stripping the feed title from item titles.
+	titlePrefixAuto = "auto"
+	// defaultReadMoreButtonText is the default text of the inline button linking to the item.
+	defaultReadMoreButtonText = "Read more"
+)
+
+// Config is the configuration of posting feeds to telegram.
+// Zero values of optional fields mean the defaults described below.
+type Config struct {
+	// FeedURLs are the urls of feeds to post, https scheme is assumed for urls without one.
+	FeedURLs []string
+	// Feeds are the feeds posted with their own chats, parse modes, templates and filters
+	// in addition to FeedURLs.
+	Feeds []FeedConfig
+	// BotAPIToken is the token of telegram bot posting the feeds.
+	BotAPIToken string
+	// BotAPITokens are the tokens of additional bots posting the items in turn with the bot of BotAPIToken,
+	// so the rate limits of telegram are spread across the bots. Every bot must be a member
+	// (an admin of channels) of every chat.
+	BotAPITokens []string
+	// APIBaseURL is the url of telegram bot api server, defaults to "https://api.telegram.org".
+	APIBaseURL string
+	// ChatIDs are the ids of telegram chats the feeds are posted to, unless Feeds set their own.
+	ChatIDs []string
+	// ThreadID is the id of the forum topic of supergroups the feeds are posted to.
+	ThreadID string
+
+	// FeedUserAgent is the User-Agent header of feed requests, defaults to the one identifying this bot.
+	FeedUserAgent string
+	// FeedUsername and FeedPassword are the credentials of basic auth of protected feeds.
+	FeedUsername, FeedPassword string
+	// FeedHeaders are the headers set on feed requests, e.g. the API key of feeds gated by a token.
+	FeedHeaders map[string]string
+	// MaxFeedBytes is the maximum size of a feed, decompressed, larger feeds fail to be fetched. Defaults to 10MB.
+	MaxFeedBytes int
+
+	// ProxyURL is the url of http, https or socks5 proxy of feed and telegram requests.
+	ProxyURL string
+	// HTTPTimeout is the timeout of feed and telegram requests, defaults to 30 seconds.
+	HTTPTimeout time.Duration
+	// RatePerSecond is the maximum number of messages sent per second to all chats, zero for no limit.
+	RatePerSecond int
+	// ChatRatePerMinute is the maximum number of messages sent per minute to a chat, zero for no limit.
+	ChatRatePerMinute int
+	// MaxAttempts is the number of attempts to send a message when rate limited, defaults to 3.
+	MaxAttempts int
+	// MaxRetries is the number of retries of feed and telegram requests failed with
+	// network errors or 5xx responses and of feeds failed to be parsed, zero means no retries.
+	MaxRetries int
+	// RetryBaseDelay is the delay before the first retry, doubled for each next one, defaults to 1 second.
+	RetryBaseDelay time.Duration
+	// ParseMode is the telegram parse mode of messages, "markdown" (default), "MarkdownV2", "HTML"
+	// or "none" for plain text sent without parse_mode.
+	ParseMode string
+	// RawHTML posts the item content as HTML sanitized to the tags telegram supports instead of
+	// converting it to markdown, it implies "HTML" parse mode.
+	RawHTML bool
+	// MessageTemplate is the text/template of messages with .Title, .Link, .Author, .Byline, .Published,
+	// .ReadingTime and .Content fields, defaults to the bold title followed by the byline, the reading time
+	// and the content.
+	MessageTemplate string
+	// DateFormat is the layout of time package the published time is formatted with in messages,
+	// defaults to the time as it is in the feed unless TimeZone is set.
+	DateFormat string
+	// TimeZone is the IANA name of time zone the published time is formatted in, defaults to UTC.
+	TimeZone string
+	// DisableWebPagePreview disables link previews in messages.
+	DisableWebPagePreview bool
+	// DisableNotification posts messages silently.
+	DisableNotification bool
+	// StripTitlePrefix is stripped from item titles with the separator following it, e.g. "MySite"
+	// of "MySite - Article". "auto" strips the feed title if the titles of all items start with it.
+	StripTitlePrefix string
+	// IncludeAuthor adds the "by {author}" byline of the item authors beneath the title of messages.
+	IncludeAuthor bool
+	// ShowReadingTime adds the reading time of the item content estimated at 200 words per minute
+	// beneath the title of messages, e.g. "3 min read".
+	ShowReadingTime bool
+	// IncludeLink appends the item link to messages.
+	IncludeLink bool
+	// TitleOnly posts the title and the link of items only, their content is not converted.
+	TitleOnly bool
+	// MaxContentChars is the maximum length of the item content in characters, longer content
+	// is truncated and followed by the item link. Zero means unlimited.
+	MaxContentChars int
+	// PreserveCodeBlocks keeps the code of the item content as is in fenced code blocks and inline code
+	// telegram renders as monospace, instead of escaping it as markdown text.
+	PreserveCodeBlocks bool
+	// StripTrackingParams removes tracking query parameters from links.
+	StripTrackingParams bool
+	// TrackingParams are the query parameters removed from links, a trailing "*" matches any
+	// parameter with the prefix. Defaults to utm_*, fbclid, gclid and other common ones.
+	TrackingParams []string
+	// IncludeCategoriesAsHashtags appends the item categories as hashtags to messages.
+	IncludeCategoriesAsHashtags bool
+	// FeedHashtag is the hashtag appended to all messages, stripped of all characters but letters,
+	// digits and underscores, e.g. "hackernews".
+	FeedHashtag string
+	// ReadMoreButton attaches an inline button linking to the item to messages.
+	ReadMoreButton bool
+	// ReadMoreButtonText is the text of the inline button linking to the item, defaults to "Read more".
+	ReadMoreButtonText string
+
+	// FilterInclude are keywords, if set only items with at least one of them are posted.
+	FilterInclude []string
+	// FilterExclude are keywords, items with any of them are not posted.
+	FilterExclude []string
+	// FilterRegexInclude is a regular expression, if set only items matching it are posted.
+	FilterRegexInclude string
+	// FilterRegexExclude is a regular expression, items matching it are not posted.
+	FilterRegexExclude string
+
+	// DedupMode is the way already posted items are detected, "time" (default), "guid" or "hash".
+	DedupMode string
+	// CrossFeedDedup skips items whose links were already posted to the chat by any of its feeds,
+	// e.g. the same article syndicated by several feeds. The links are recorded per chat for
+	// CrossFeedDedupTTL, defaults to 72 hours, in stores that are LinkRecorder.
+	CrossFeedDedup    bool
+	CrossFeedDedupTTL time.Duration
+	// ResolveCanonicalURL fetches the article of each posted item and links the message to the url of
+	// its <link rel="canonical">, keeping the item link if the article fails to be fetched within
+	// CanonicalURLTimeout, defaults to 5 seconds, or it has no canonical link.
+	ResolveCanonicalURL bool
+	CanonicalURLTimeout time.Duration
+	// MaxItemsPerRun is the maximum number of items posted per feed in a single run, zero means unlimited.
+	MaxItemsPerRun int
+	// ActiveHoursStart and ActiveHoursEnd are the hours of the day (0-23, in TimeZone) items are
+	// posted between, the end hour excluded. Runs outside of the window are skipped, so items are
+	// posted when the window opens. Equal hours (the default) mean posting at any time.
+	ActiveHoursStart, ActiveHoursEnd int
+	// BackfillOnFirstRun posts the items already in a feed on its first run in a chat,
+	// otherwise they are recorded as posted and only the items published afterwards are posted.
+	BackfillOnFirstRun bool
+	// RepostUpdated reposts already posted items whose updated time moved forward, their titles
+	// marked as updated, at most 3 times per item.
+	RepostUpdated bool
+	// MinItemAge is the minimum age of an item to be posted, newer items are posted on the next runs.
+	MinItemAge time.Duration
+	// MinItemDate is the time items published before are never posted, e.g. the history of a feed
+	// added to a chat. Zero means no cutoff.
+	MinItemDate time.Time
+	// SendConcurrency is the number of items sent at a time, defaults to 1.
+	SendConcurrency int
+	// SendDelay is the pause between sending consecutive items, zero means no pause.
+	SendDelay time.Duration
+	// FeedTitlePrefix prepends the feed title to messages, so feeds posted to the same chat are distinguishable.
+	FeedTitlePrefix bool
+	// MessagePrefix is prepended to messages as is, e.g. an emoji marking the feeds posted to a shared chat.
+	MessagePrefix string
+	// FeedImageAsPhoto posts items without an image as a photo of the feed image (logo) if the feed has one.
+	FeedImageAsPhoto bool
+	// SendEnclosures posts items with a document enclosure (e.g. a PDF) as a document with the text as a caption.
+	// Document enclosures are ignored otherwise, video, audio and image enclosures are posted as the media anyway.
+	SendEnclosures bool
+	// DigestMode posts the new items of each feed in a run as a single message of their
+	// titles and links instead of a message per item.
+	DigestMode bool
+	// LockLease is the time a feed of a chat stays locked by a run that crashed before unlocking it,
+	// defaults to 10 minutes. Feeds locked by another run are skipped.
+	LockLease time.Duration
+	// ValidateOnStart checks the bot token and that the bot is a member of the chats before
+	// processing any feed, so a misconfigured run fails with a descriptive error.
+	ValidateOnStart bool
+	// MessageTTL is the time ids of processed Pub/Sub messages are recorded for, so their
+	// redeliveries are skipped, defaults to 1 hour.
+	MessageTTL time.Duration
+	// DryRun logs messages instead of posting them and keeps the state of chats intact.
+	DryRun bool
+	// AdminChatID is the id of telegram chat the summary of failures of a run is posted to.
+	AdminChatID string
+	// FirestoreCollection is the firestore collection the state of chats is stored in, defaults to "chats".
+	FirestoreCollection string
+	// FirestoreClient is the client the state of chats is stored with, defaults to a global client
+	// of GCP_PROJECT project initialized on first use.
+	FirestoreClient *firestore.Client
+	// LogLevel is the minimum level of logged events, "debug", "info" (default), "warn" or "error".
+	LogLevel string
+	// StoreBackend is the storage of the state of chats, "firestore" (default), "file" or "redis".
+	StoreBackend string
+	// StoreFilePath is the path of the JSON file the state of chats is stored in by the file backend,
+	// defaults to "rss2telegram.json".
+	StoreFilePath string
+	// RedisURL is the url of redis server the state of chats is stored in by the redis backend,
+	// e.g. "redis://localhost:6379/0".
+	RedisURL string
+	// Store is the storage of the state of chats, overrides StoreBackend if set.
+	Store Store
+}
+
+// ConfigFromEnv returns Config read from such environment variables:
+// - RSS_FEED_URL (comma-separated list of feed urls, optional if CONFIG_FILE, OPML_FILE or FEEDS_JSON is set)
+// - TELEGRAM_BOT_API_TOKEN (comma-separated list of tokens of bots posting the items in turn)
+// - TELEGRAM_CHAT_ID (comma-separated list of chat ids, optional if CONFIG_FILE, OPML_FILE or FEEDS_JSON feeds set their own)
+// - CONFIG_FILE (optional, path of YAML file of feeds with their own settings, see readConfigFile)
+// - OPML_FILE (optional, path of OPML file of feeds exported from a feed reader, see readOPMLFile)
+// - FEEDS_JSON (optional, JSON array of feeds with their own settings, see parseFeedsJSON)
+// - FEED_USER_AGENT (optional, User-Agent header of feed requests)
+// - FEED_USERNAME and FEED_PASSWORD (optional, credentials of basic auth of feeds)
+// - FEED_HEADERS (optional, JSON object of headers of feed requests, e.g. {"X-API-Key": "..."})
+// - TELEGRAM_API_BASE_URL (optional, defaults to "https://api.telegram.org")
+// - TELEGRAM_THREAD_ID (optional, forum topic id)
+// - PROXY_URL (optional, http://, https:// or socks5:// proxy url)
+// - HTTP_TIMEOUT_SECONDS (optional, defaults to 30)
+// - MAX_FEED_BYTES (optional, defaults to 10MB)
+// - TELEGRAM_MAX_ATTEMPTS (optional, defaults to 3)
+// - MAX_RETRIES (optional, defaults to 2)
+// - TELEGRAM_RATE_PER_SECOND (optional, defaults to 30, 0 for no limit)
+// - TELEGRAM_CHAT_RATE_PER_MINUTE (optional, defaults to 20, 0 for no limit)
+// - RETRY_BASE_DELAY (optional, defaults to 1s)
+// - TELEGRAM_PARSE_MODE (optional, "markdown", "MarkdownV2", "HTML" or "none", defaults to "markdown")
+// - RAW_HTML (optional, defaults to false)
+// - MESSAGE_TEMPLATE (optional, text/template with .Title, .Link, .Author, .Byline, .Published, .ReadingTime and .Content)
+// - DATE_FORMAT (optional, layout of time package, e.g. "02 Jan 2006 15:04")
+// - TIME_ZONE (optional, IANA time zone name, defaults to UTC)
+// - DISABLE_WEB_PAGE_PREVIEW (optional, defaults to true)
+// - DISABLE_NOTIFICATION (optional, defaults to false)
+// - INCLUDE_LINK (optional, defaults to true)
+// - TITLE_ONLY (optional, defaults to false)
+// - INCLUDE_AUTHOR (optional, defaults to false)
+// - SHOW_READING_TIME (optional, defaults to false)
+// - STRIP_TITLE_PREFIX (optional, prefix of item titles or "auto" for the feed title)
+// - MAX_CONTENT_CHARS (optional, maximum length of the item content, unlimited by default)
+// - PRESERVE_CODE_BLOCKS (optional, defaults to false)
+// - STRIP_TRACKING_PARAMS (optional, defaults to false)
+// - TRACKING_PARAMS (optional, comma-separated list of query parameters, "utm_*" matches a prefix)
+// - INCLUDE_CATEGORIES_AS_HASHTAGS (optional, defaults to false)
+// - FEED_HASHTAG (optional, e.g. "hackernews")
+// - INLINE_READ_MORE_BUTTON (optional, defaults to false)
+// - READ_MORE_BUTTON_TEXT (optional, defaults to "Read more")
+// - FILTER_INCLUDE (optional, comma-separated list of keywords)
+// - FILTER_EXCLUDE (optional, comma-separated list of keywords)
+// - FILTER_REGEX_INCLUDE (optional, regular expression)
+// - FILTER_REGEX_EXCLUDE (optional, regular expression)
+// - DEDUP_MODE (optional, "time", "guid" or "hash", defaults to "time")
+// - CROSS_FEED_DEDUP (optional, defaults to false)
+// - CROSS_FEED_DEDUP_TTL (optional, defaults to 72h)
+// - RESOLVE_CANONICAL_URL (optional, defaults to false)
+// - CANONICAL_URL_TIMEOUT (optional, defaults to 5s)
+// - MAX_ITEMS_PER_RUN (optional, maximum number of items posted per feed in a single run)
+// - BACKFILL_ON_FIRST_RUN (optional, defaults to false)
+// - REPOST_UPDATED (optional, defaults to false)
+// - MIN_ITEM_AGE_SECONDS (optional, minimum age of an item to be posted)
+// - MIN_ITEM_DATE (optional, RFC3339 time or date items published before are not posted)
+// - ACTIVE_HOURS_START, ACTIVE_HOURS_END (optional, hours of the day items are posted between)
+// - SEND_CONCURRENCY (optional, defaults to 1)
+// - SEND_DELAY_MS (optional, pause between sending items in milliseconds, defaults to 0)
+// - DIGEST_MODE (optional, defaults to false)
+// - FEED_TITLE_PREFIX (optional, defaults to false)
+// - MESSAGE_PREFIX (optional, e.g. an emoji)
+// - FEED_IMAGE_AS_PHOTO (optional, defaults to false)
+// - SEND_ENCLOSURES (optional, defaults to false)
+// - LOCK_LEASE (optional, defaults to 10m)
+// - MESSAGE_TTL (optional, defaults to 1h)
+// - VALIDATE_ON_START (optional, defaults to false)
+// - DRY_RUN (optional, defaults to false)
+// - ADMIN_CHAT_ID (optional, chat id the summary of failures is posted to)
+// - FIRESTORE_COLLECTION (optional, defaults to "chats")
+// - LOG_LEVEL (optional, "debug", "info", "warn" or "error", defaults to "info")
+// - STORE_BACKEND (optional, "firestore", "file" or "redis", defaults to "firestore")
+// - STORE_FILE_PATH (optional, defaults to "rss2telegram.json")
+// - REDIS_URL (required by the redis backend)
+func ConfigFromEnv() (Config, error) {
+	return configFromEnv(messagePayload{})
+}
+
+// configFromEnv returns Config read from the environment variables of ConfigFromEnv
+// with the feed and the chat overridden by payload p if it sets them.
+func configFromEnv(p messagePayload) (Config, error) {
+	cfg := Config{
+		FeedURLs:            splitList(os.Getenv("RSS_FEED_URL")),
+		FeedUserAgent:       os.Getenv("FEED_USER_AGENT"),
+		FeedUsername:        os.Getenv("FEED_USERNAME"),
+		FeedPassword:        os.Getenv("FEED_PASSWORD"),
+		APIBaseURL:          os.Getenv("TELEGRAM_API_BASE_URL"),
+		ChatIDs:             splitList(os.Getenv("TELEGRAM_CHAT_ID")),
+		ThreadID:            os.Getenv("TELEGRAM_THREAD_ID"),
+		ParseMode:           os.Getenv("TELEGRAM_PARSE_MODE"),
+		ProxyURL:            os.Getenv("PROXY_URL"),
+		MessageTemplate:     os.Getenv("MESSAGE_TEMPLATE"),
+		MessagePrefix:       os.Getenv("MESSAGE_PREFIX"),
+		FeedHashtag:         os.Getenv("FEED_HASHTAG"),
+		DateFormat:          os.Getenv("DATE_FORMAT"),
+		TimeZone:            os.Getenv("TIME_ZONE"),
+		ReadMoreButtonText:  os.Getenv("READ_MORE_BUTTON_TEXT"),
+		StripTitlePrefix:    os.Getenv("STRIP_TITLE_PREFIX"),
+		TrackingParams:      splitList(os.Getenv("TRACKING_PARAMS")),
+		FilterInclude:       splitList(os.Getenv("FILTER_INCLUDE")),
+		FilterExclude:       splitList(os.Getenv("FILTER_EXCLUDE")),
+		FilterRegexInclude:  os.Getenv("FILTER_REGEX_INCLUDE"),
+		FilterRegexExclude:  os.Getenv("FILTER_REGEX_EXCLUDE"),
+		DedupMode:           os.Getenv("DEDUP_MODE"),
+		AdminChatID:         os.Getenv("ADMIN_CHAT_ID"),
+		FirestoreCollection: os.Getenv("FIRESTORE_COLLECTION"),
+		LogLevel:            os.Getenv("LOG_LEVEL"),
+		StoreBackend:        os.Getenv("STORE_BACKEND"),
+		StoreFilePath:       os.Getenv("STORE_FILE_PATH"),
+		RedisURL:            os.Getenv("REDIS_URL"),
+	}
+	var err error
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if cfg.Feeds, err = readConfigFile(path); err != nil {
+			return Config{}, err
+		}
+	}
+	if path := os.Getenv("OPML_FILE"); path != "" {
+		feeds, err := readOPMLFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.Feeds = append(cfg.Feeds, feeds...)
+	}
+	if v := os.Getenv("FEEDS_JSON"); v != "" {
+		feeds, err := parseFeedsJSON(v)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.Feeds = append(cfg.Feeds, feeds...)
+	}
+	if tokens := splitList(os.Getenv("TELEGRAM_BOT_API_TOKEN")); len(tokens) > 0 {
+		cfg.BotAPIToken, cfg.BotAPITokens = tokens[0], tokens[1:]
+	}
+	p.apply(&cfg)
+
+	// all the missing variables are reported at once, in the order they are documented in
+	var missing []string
+	if len(cfg.FeedURLs) == 0 && len(cfg.Feeds) == 0 {
+		missing = append(missing, "RSS_FEED_URL")
+	}
+	if cfg.BotAPIToken == "" {
+		missing = append(missing, "TELEGRAM_BOT_API_TOKEN")
+	}
+	if len(cfg.ChatIDs) == 0 {
+		var feedURL string
+		for _, fc := range cfg.Feeds {
+			if len(fc.ChatIDs) == 0 {
+				feedURL = fc.URL
+				break
+			}
+		}
+		switch {
+		case feedURL != "":
+			missing = append(missing, fmt.Sprintf("TELEGRAM_CHAT_ID (feed %s has no chat_ids)", feedURL))
+		case len(cfg.FeedURLs) > 0 || len(cfg.Feeds) == 0:
+			missing = append(missing, "TELEGRAM_CHAT_ID")
+		}
+	}
+	if err := missingEnvError(missing); err != nil {
+		return Config{}, err
+	}
+
+	if v := os.Getenv("FEED_HEADERS"); v != "" {
+		// the values are secrets, so they are not included in the error
+		if err := json.Unmarshal([]byte(v), &cfg.FeedHeaders); err != nil {
+			return Config{}, errors.New("environment variable FEED_HEADERS is not a JSON object of strings")
+		}
+	}
+
+	var httpTimeout int
+	if httpTimeout, err = envInt("HTTP_TIMEOUT_SECONDS", int(defaultHTTPTimeout/time.Second)); err != nil {
+		return Config{}, err
+	}
+	cfg.HTTPTimeout = time.Duration(httpTimeout) * time.Second
+	if cfg.MaxFeedBytes, err = envInt("MAX_FEED_BYTES", defaultMaxFeedBytes); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxAttempts, err = envInt("TELEGRAM_MAX_ATTEMPTS", defaultMaxAttempts); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxRetries, err = envCount("MAX_RETRIES", defaultMaxRetries); err != nil {
+		return Config{}, err
+	}
+	if cfg.RatePerSecond, err = envCount("TELEGRAM_RATE_PER_SECOND", defaultRatePerSecond); err != nil {
+		return Config{}, err
+	}
+	if cfg.ChatRatePerMinute, err = envCount("TELEGRAM_CHAT_RATE_PER_MINUTE", defaultChatRatePerMinute); err != nil {
+		return Config{}, err
+	}
+	if cfg.RetryBaseDelay, err = envDuration("RETRY_BASE_DELAY", defaultRetryBaseDelay); err != nil {
+		return Config{}, err
+	}
+	if cfg.LockLease, err = envDuration("LOCK_LEASE", defaultLockLease); err != nil {
+		return Config{}, err
+	}
+	if cfg.MessageTTL, err = envDuration("MESSAGE_TTL", defaultMessageTTL); err != nil {
+		return Config{}, err
+	}
+	if cfg.CrossFeedDedup, err = envBool("CROSS_FEED_DEDUP", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.CrossFeedDedupTTL, err = envDuration("CROSS_FEED_DEDUP_TTL", defaultCrossFeedDedupTTL); err != nil {
+		return Config{}, err
+	}
+	if cfg.ResolveCanonicalURL, err = envBool("RESOLVE_CANONICAL_URL", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.CanonicalURLTimeout, err = envDuration("CANONICAL_URL_TIMEOUT", defaultCanonicalURLTimeout); err != nil {
+		return Config{}, err
+	}
+	if cfg.ValidateOnStart, err = envBool("VALIDATE_ON_START", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.RawHTML, err = envBool("RAW_HTML", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.DisableWebPagePreview, err = envBool("DISABLE_WEB_PAGE_PREVIEW", true); err != nil {
+		return Config{}, err
+	}
+	if cfg.DisableNotification, err = envBool("DISABLE_NOTIFICATION", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.IncludeLink, err = envBool("INCLUDE_LINK", true); err != nil {
+		return Config{}, err
+	}
+	if cfg.TitleOnly, err = envBool("TITLE_ONLY", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.IncludeAuthor, err = envBool("INCLUDE_AUTHOR", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.ShowReadingTime, err = envBool("SHOW_READING_TIME", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxContentChars, err = envCount("MAX_CONTENT_CHARS", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.PreserveCodeBlocks, err = envBool("PRESERVE_CODE_BLOCKS", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.StripTrackingParams, err = envBool("STRIP_TRACKING_PARAMS", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.IncludeCategoriesAsHashtags, err = envBool("INCLUDE_CATEGORIES_AS_HASHTAGS", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.ReadMoreButton, err = envBool("INLINE_READ_MORE_BUTTON", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.DigestMode, err = envBool("DIGEST_MODE", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.FeedTitlePrefix, err = envBool("FEED_TITLE_PREFIX", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.FeedImageAsPhoto, err = envBool("FEED_IMAGE_AS_PHOTO", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.SendEnclosures, err = envBool("SEND_ENCLOSURES", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.DryRun, err = envBool("DRY_RUN", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxItemsPerRun, err = envCount("MAX_ITEMS_PER_RUN", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.BackfillOnFirstRun, err = envBool("BACKFILL_ON_FIRST_RUN", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.RepostUpdated, err = envBool("REPOST_UPDATED", false); err != nil {
+		return Config{}, err
+	}
+	var minItemAge int
+	if minItemAge, err = envCount("MIN_ITEM_AGE_SECONDS", 0); err != nil {
+		return Config{}, err
+	}
+	cfg.MinItemAge = time.Duration(minItemAge) * time.Second
+	if cfg.MinItemDate, err = envTime("MIN_ITEM_DATE"); err != nil {
+		return Config{}, err
+	}
+	if cfg.ActiveHoursStart, err = envCount("ACTIVE_HOURS_START", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.ActiveHoursEnd, err = envCount("ACTIVE_HOURS_END", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.SendConcurrency, err = envInt("SEND_CONCURRENCY", defaultConcurrency); err != nil {
+		return Config{}, err
+	}
+	var sendDelay int
+	if sendDelay, err = envCount("SEND_DELAY_MS", 0); err != nil {
+		return Config{}, err
+	}
+	cfg.SendDelay = time.Duration(sendDelay) * time.Millisecond
+
+	return cfg, nil
+}
+
+// settings validates cfg and returns the settings of the telegram bot and of processing feeds.
+func (cfg Config) settings() (telegramBot, feedOptions, error) {
+	if len(cfg.FeedURLs) == 0 && len(cfg.Feeds) == 0 {
+		return telegramBot{}, feedOptions{}, errors.New("config: no feed urls")
+	}
+	if len(cfg.FeedURLs) > 0 && len(cfg.ChatIDs) == 0 {
+		return telegramBot{}, feedOptions{}, errors.New("config: no telegram chat ids")
+	}
+	return cfg.botSettings()
+}
+
+// botSettings validates cfg except for the feeds and the chats and returns the settings
+// of the telegram bot and of processing feeds.
+func (cfg Config) botSettings() (telegramBot, feedOptions, error) {
+	if cfg.BotAPIToken == "" {
+		return telegramBot{}, feedOptions{}, errors.New("config: no telegram bot api token")
+	}
+	botTokens := []string{cfg.BotAPIToken}
+	for _, token := range cfg.BotAPITokens {
+		if token == "" {
+			return telegramBot{}, feedOptions{}, errors.New("config: empty telegram bot api token")
+		}
+		botTokens = append(botTokens, token)
+	}
+
+	parseMode, err := parseParseMode(cfg.ParseMode)
+	if err != nil {
+		return telegramBot{}, feedOptions{}, fmt.Errorf("config: %v", err)
+	}
+	if cfg.RawHTML {
+		// the content is sanitized instead of converted to markdown in HTML parse mode
+		if cfg.ParseMode != "" && parseMode != parseModeHTML {
+			return telegramBot{}, feedOptions{}, fmt.Errorf("config: raw html conflicts with parse mode %q", cfg.ParseMode)
+		}
+		parseMode = parseModeHTML
+	}
+	tmpl, err := parseMessageTemplate(cfg.MessageTemplate, parseMode)
+	if err != nil {
+		return telegramBot{}, feedOptions{}, fmt.Errorf("config: invalid message template: %v", err)
+	}
+
+	filter, err := compileItemFilter(cfg.FilterInclude, cfg.FilterExclude, cfg.FilterRegexInclude, cfg.FilterRegexExclude)
+	if err != nil {
+		return telegramBot{}, feedOptions{}, fmt.Errorf("config: %v", err)
+	}
+
+	level, err := parseLogLevel(cfg.LogLevel)
+	if err != nil {
+		return telegramBot{}, feedOptions{}, fmt.Errorf("config: unknown log level %q", cfg.LogLevel)
+	}
+
+	dedupMode := cfg.DedupMode
+	switch dedupMode {
+	case "":
+		dedupMode = dedupModeTime
+	case dedupModeTime, dedupModeGUID, dedupModeHash:
+	default:
+		return telegramBot{}, feedOptions{}, fmt.Errorf("config: unknown dedup mode %q", dedupMode)
+	}
+
+	dateLayout := cfg.DateFormat
+	location := time.UTC
+	if cfg.TimeZone != "" {
+		if location, err = time.LoadLocation(cfg.TimeZone); err != nil {
+			return telegramBot{}, feedOptions{}, fmt.Errorf("config: invalid time zone: %v", err)
+		}
+		if dateLayout == "" {
+			dateLayout = defaultDateFormat
+		}
+	}
+
+	if cfg.ActiveHoursStart > 23 || cfg.ActiveHoursEnd > 23 || cfg.ActiveHoursStart < 0 || cfg.ActiveHoursEnd < 0 {
+		return telegramBot{}, feedOptions{}, errors.New("config: active hours must be between 0 and 23")
+	}
+
+	var trackingParams []string
+	if cfg.StripTrackingParams {
+		trackingParams = cfg.TrackingParams
+		if len(trackingParams) == 0 {
+			trackingParams = defaultTrackingParams
+		}
+	}
+
+	// the auto-detected prefix is set per feed
+	var titlePrefix string
+	if cfg.StripTitlePrefix != titlePrefixAuto {
+		titlePrefix = cfg.StripTitlePrefix
+	}
+
+	hashtag := feedHashtag(cfg.FeedHashtag)
+	if cfg.FeedHashtag != "" && hashtag == "" {
+		return telegramBot{}, feedOptions{}, fmt.Errorf("config: invalid feed hashtag %q", cfg.FeedHashtag)
+	}
+
+	var readMoreButton string
+	if cfg.ReadMoreButton {
+		readMoreButton = orString(cfg.ReadMoreButtonText, defaultReadMoreButtonText)
+	}
+
+	httpClient, err := newHTTPClient(cfg.ProxyURL, orDuration(cfg.HTTPTimeout, defaultHTTPTimeout))
+	if err != nil {
+		return telegramBot{}, feedOptions{}, fmt.Errorf("config: %v", err)
+	}
+
+	retry := retryPolicy{
+		maxRetries: cfg.MaxRetries,
+		baseDelay:  orDuration(cfg.RetryBaseDelay, defaultRetryBaseDelay),
+	}
+
+	// the first bot of the pool is the bot of BotAPIToken, so it shares its rate limiter
+	limiter := newRateLimiter(cfg.RatePerSecond, cfg.ChatRatePerMinute)
+	pool := newBotPool(botTokens, cfg.RatePerSecond, cfg.ChatRatePerMinute)
+	if pool != nil {
+		limiter = pool.limiters[0]
+	}
+
+	bot := telegramBot{
+		apiBaseURL:            orString(cfg.APIBaseURL, defaultAPIBaseURL),
+		apiToken:              cfg.BotAPIToken,
+		client:                httpClient,
+		maxAttempts:           orInt(cfg.MaxAttempts, defaultMaxAttempts),
+		retry:                 retry,
+		limiter:               limiter,
+		pool:                  pool,
+		threadID:              cfg.ThreadID,
+		disableWebPagePreview: cfg.DisableWebPagePreview,
+		disableNotification:   cfg.DisableNotification,
+		readMoreButton:        readMoreButton,
+		sendEnclosures:        cfg.SendEnclosures,
+		dryRun:                cfg.DryRun,
+		message: messageOptions{
+			parseMode:       parseMode,
+			template:        tmpl,
+			includeLink:     cfg.IncludeLink || cfg.TitleOnly,
+			titleOnly:       cfg.TitleOnly,
+			includeAuthor:   cfg.IncludeAuthor,
+			showReadingTime: cfg.ShowReadingTime,
+			titlePrefix:     titlePrefix,
+			preserveCode:    cfg.PreserveCodeBlocks,
+			prefix:          cfg.MessagePrefix,
+			maxContentChars: cfg.MaxContentChars,
+			trackingParams:  trackingParams,
+			dateLayout:      dateLayout,
+			location:        location,
+			includeHashtags: cfg.IncludeCategoriesAsHashtags,
+			hashtag:         hashtag,
+		},
+	}
+	opts := feedOptions{
+		client:            httpClient,
+		userAgent:         orString(cfg.FeedUserAgent, defaultUserAgent),
+		username:          cfg.FeedUsername,
+		password:          cfg.FeedPassword,
+		headers:           cfg.FeedHeaders,
+		maxFeedBytes:      orInt(cfg.MaxFeedBytes, defaultMaxFeedBytes),
+		retry:             retry,
+		dedupMode:         dedupMode,
+		filter:            filter,
+		maxItems:          cfg.MaxItemsPerRun,
+		logLevel:          level,
+		concurrency:       orInt(cfg.SendConcurrency, defaultConcurrency),
+		sendDelay:         cfg.SendDelay,
+		digest:            cfg.DigestMode,
+		feedTitlePrefix:   cfg.FeedTitlePrefix,
+		feedImage:         cfg.FeedImageAsPhoto,
+		backfill:          cfg.BackfillOnFirstRun,
+		repostUpdated:     cfg.RepostUpdated,
+		autoTitlePrefix:   cfg.StripTitlePrefix == titlePrefixAuto,
+		lockLease:         orDuration(cfg.LockLease, defaultLockLease),
+		minItemAge:        cfg.MinItemAge,
+		minItemDate:       cfg.MinItemDate,
+		crossFeedDedup:    cfg.CrossFeedDedup,
+		crossFeedDedupTTL: orDuration(cfg.CrossFeedDedupTTL, defaultCrossFeedDedupTTL),
+		resolveCanonical:  cfg.ResolveCanonicalURL,
+		canonicalTimeout:  orDuration(cfg.CanonicalURLTimeout, defaultCanonicalURLTimeout),
+		activeHours:       hourWindow{start: cfg.ActiveHoursStart, end: cfg.ActiveHoursEnd, location: location},
+		dryRun:            cfg.DryRun,
+	}
+
+	return bot, opts, nil
+}
+
+// newHTTPClient returns http client with timeout using proxy at proxyURL if it is set.
+func newHTTPClient(proxyURL string, timeout time.Duration) (*http.Client, error) {
+	client := &http.Client{Timeout: timeout}
+	if proxyURL == "" {
+		return client, nil
+	}
+
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url: %v", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid proxy url %q: scheme must be http, https or socks5", proxyURL)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy url %q: no host", proxyURL)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(u)
+	client.Transport = transport
+
+	return client, nil
+}
+
+// compileRegexp compiles regular expression expr, returns nil if expr is empty.
+func compileRegexp(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	return regexp.Compile(expr)
+}
+
+// orInt returns v, or def if v is not positive.
+func orInt(v, def int) int {
+	if v > 0 {
+		return v
+	}
+	return def
+}
+
+// orString returns s, or def if s is empty.
+func orString(s, def string) string {
+	if s != "" {
+		return s
+	}
+	return def
+}
+
+// orDuration returns d, or def if d is not positive.
+func orDuration(d, def time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return def
+}
+
+// splitList splits comma-separated s into a list of trimmed non-empty values.
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// store returns the Store of the state of chats selected by cfg.
+func (cfg Config) store() (Store, error) {
+	if cfg.Store != nil {
+		return cfg.Store, nil
+	}
+
+	switch cfg.StoreBackend {
+	case "", storeBackendFirestore:
+		fsClient := cfg.FirestoreClient
+		if fsClient == nil {
+			var err error
+			if fsClient, err = firestoreClient(); err != nil {
+				return nil, err
+			}
+		}
+		return firestoreStore{client: fsClient, chats: fsClient.Collection(orString(cfg.FirestoreCollection, defaultCollection))}, nil
+	case storeBackendFile:
+		return newFileStore(orString(cfg.StoreFilePath, defaultStoreFilePath)), nil
+	case storeBackendRedis:
+		if cfg.RedisURL == "" {
+			return nil, errors.New("config: no redis url")
+		}
+		return newRedisStore(cfg.RedisURL), nil
+	default:
+		return nil, fmt.Errorf("config: unknown store backend %q", cfg.StoreBackend)
+	}
+}
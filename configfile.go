@@ -0,0 +1,225 @@
+package rss2telegram
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+
+	"gopkg.in/yaml.v2"
+)
+
+// FeedConfig is the configuration of posting a single feed. Zero values of optional fields
+// mean the settings of the Config the feed belongs to.
+type FeedConfig struct {
+	// URL is the url of the feed.
+	URL string `yaml:"url" json:"url"`
+	// ChatIDs are the ids of telegram chats the feed is posted to.
+	ChatIDs []string `yaml:"chat_ids" json:"chat_ids"`
+	// ParseMode is the telegram parse mode of messages, "markdown", "MarkdownV2", "HTML" or "none".
+	ParseMode string `yaml:"parse_mode" json:"parse_mode"`
+	// MessageTemplate is the text/template of messages, see Config.MessageTemplate.
+	MessageTemplate string `yaml:"message_template" json:"message_template"`
+	// MessagePrefix is prepended to messages as is, e.g. an emoji.
+	MessagePrefix string `yaml:"message_prefix" json:"message_prefix"`
+	// Hashtag is the hashtag appended to messages, see Config.FeedHashtag.
+	Hashtag string `yaml:"hashtag" json:"hashtag"`
+	// FilterInclude are keywords, if set only items with at least one of them are posted.
+	FilterInclude []string `yaml:"filter_include" json:"filter_include"`
+	// FilterExclude are keywords, items with any of them are not posted.
+	FilterExclude []string `yaml:"filter_exclude" json:"filter_exclude"`
+	// FilterRegexInclude is a regular expression, if set only items matching it are posted.
+	FilterRegexInclude string `yaml:"filter_regex_include" json:"filter_regex_include"`
+	// FilterRegexExclude is a regular expression, items matching it are not posted.
+	FilterRegexExclude string `yaml:"filter_regex_exclude" json:"filter_regex_exclude"`
+}
+
+// configFile is the YAML file of CONFIG_FILE environment variable, its feeds are decoded one at a time
+// so the errors name the invalid one.
+type configFile struct {
+	Feeds []yaml.MapSlice `yaml:"feeds"`
+}
+
+// chatIDPattern matches telegram chat ids, numeric ids and @usernames of channels and groups.
+var chatIDPattern = regexp.MustCompile(`^(-?[0-9]+|@[A-Za-z][A-Za-z0-9_]{3,31})$`)
+
+// readConfigFile returns the feeds of YAML config file at path, e.g.
+//
+//	feeds:
+//	  - url: https://example.com/feed.xml
+//	    chat_ids: ["@examplechannel"]
+//	    parse_mode: HTML
+//	    filter_include: [golang]
+//
+// Unknown fields are reported as errors, so typos do not silently fall back to the defaults.
+func readConfigFile(path string) ([]FeedConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config file: %v", err)
+	}
+
+	var f configFile
+	if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		return nil, fmt.Errorf("config file %s: %v", path, err)
+	}
+	feeds := make([]FeedConfig, len(f.Feeds))
+	for i, entry := range f.Feeds {
+		data, err := yaml.Marshal(entry)
+		if err == nil {
+			err = yaml.UnmarshalStrict(data, &feeds[i])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("config file %s: feed %d: %v", path, i+1, err)
+		}
+	}
+	if err := validateFeedConfigs(feeds); err != nil {
+		return nil, fmt.Errorf("config file %s: %v", path, err)
+	}
+
+	return feeds, nil
+}
+
+// parseFeedsJSON returns the feeds of JSON array s with the fields of the config file, e.g.
+// [{"url": "https://example.com/feed.xml", "chat_ids": ["@examplechannel"], "parse_mode": "HTML"}].
+func parseFeedsJSON(s string) ([]FeedConfig, error) {
+	var entries []json.RawMessage
+	if err := json.Unmarshal([]byte(s), &entries); err != nil {
+		return nil, fmt.Errorf("environment variable FEEDS_JSON: %v", err)
+	}
+	feeds := make([]FeedConfig, len(entries))
+	for i, entry := range entries {
+		d := json.NewDecoder(bytes.NewReader(entry))
+		d.DisallowUnknownFields()
+		if err := d.Decode(&feeds[i]); err != nil {
+			return nil, fmt.Errorf("environment variable FEEDS_JSON: feed %d: %v", i+1, err)
+		}
+	}
+	if err := validateFeedConfigs(feeds); err != nil {
+		return nil, fmt.Errorf("environment variable FEEDS_JSON: %v", err)
+	}
+	return feeds, nil
+}
+
+// validateFeedConfigs reports the first of feeds without url or with an invalid chat id or parse mode,
+// or an error if there are no feeds.
+func validateFeedConfigs(feeds []FeedConfig) error {
+	if len(feeds) == 0 {
+		return errors.New("no feeds")
+	}
+	for i, fc := range feeds {
+		if fc.URL == "" {
+			return fmt.Errorf("feed %d: no url", i+1)
+		}
+		for _, chatID := range fc.ChatIDs {
+			if !chatIDPattern.MatchString(chatID) {
+				return fmt.Errorf("feed %d: invalid chat id %q", i+1, chatID)
+			}
+		}
+		if _, err := parseParseMode(fc.ParseMode); err != nil {
+			return fmt.Errorf("feed %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// feedRoute is a feed posted to a telegram chat with its own settings and state.
+type feedRoute struct {
+	feedURL, chatID string
+	bot             telegramBot
+	opts            feedOptions
+}
+
+// routes returns the feeds of cfg posted to each of their chats, the feeds of cfg.FeedURLs
+// posted to cfg.ChatIDs with the settings bot and opts followed by cfg.Feeds with their overrides.
+func (cfg Config) routes(bot telegramBot, opts feedOptions) ([]feedRoute, error) {
+	var routes []feedRoute
+	for _, fc := range cfg.feedConfigs() {
+		feedURL, err := normalizeFeedURL(fc.URL)
+		if err != nil {
+			return nil, fmt.Errorf("config: %v", err)
+		}
+		feedBot, feedOpts, err := fc.settings(cfg, bot, opts)
+		if err != nil {
+			return nil, fmt.Errorf("config: feed %s: %v", feedURL, err)
+		}
+
+		chatIDs := fc.ChatIDs
+		if len(chatIDs) == 0 {
+			chatIDs = cfg.ChatIDs
+		}
+		if len(chatIDs) == 0 {
+			return nil, fmt.Errorf("config: feed %s: no telegram chat ids", feedURL)
+		}
+		// each chat keeps its own state of the feed, so the feed is processed per chat
+		for _, chatID := range chatIDs {
+			routes = append(routes, feedRoute{feedURL: feedURL, chatID: chatID, bot: feedBot, opts: feedOpts})
+		}
+	}
+	return routes, nil
+}
+
+// feedConfigs returns cfg.FeedURLs as feed configs without overrides followed by cfg.Feeds.
+func (cfg Config) feedConfigs() []FeedConfig {
+	feeds := make([]FeedConfig, 0, len(cfg.FeedURLs)+len(cfg.Feeds))
+	for _, feedURL := range cfg.FeedURLs {
+		feeds = append(feeds, FeedConfig{URL: feedURL})
+	}
+	return append(feeds, cfg.Feeds...)
+}
+
+// feedURLs returns the urls of all feeds of cfg.
+func (cfg Config) feedURLs() []string {
+	var urls []string
+	for _, fc := range cfg.feedConfigs() {
+		urls = append(urls, fc.URL)
+	}
+	return urls
+}
+
+// settings returns bot and opts of cfg with the overrides of fc applied.
+func (fc FeedConfig) settings(cfg Config, bot telegramBot, opts feedOptions) (telegramBot, feedOptions, error) {
+	var err error
+	if fc.ParseMode != "" || fc.MessageTemplate != "" {
+		if fc.ParseMode != "" {
+			if bot.message.parseMode, err = parseParseMode(fc.ParseMode); err != nil {
+				return bot, opts, err
+			}
+		}
+		tmpl := orString(fc.MessageTemplate, cfg.MessageTemplate)
+		if bot.message.template, err = parseMessageTemplate(tmpl, bot.message.parseMode); err != nil {
+			return bot, opts, fmt.Errorf("invalid message template: %v", err)
+		}
+	}
+
+	if fc.MessagePrefix != "" {
+		bot.message.prefix = fc.MessagePrefix
+	}
+	if fc.Hashtag != "" {
+		if bot.message.hashtag = feedHashtag(fc.Hashtag); bot.message.hashtag == "" {
+			return bot, opts, fmt.Errorf("invalid hashtag %q", fc.Hashtag)
+		}
+	}
+
+	if len(fc.FilterInclude) > 0 || len(fc.FilterExclude) > 0 || fc.FilterRegexInclude != "" || fc.FilterRegexExclude != "" {
+		if opts.filter, err = newFeedFilter(fc, cfg); err != nil {
+			return bot, opts, err
+		}
+	}
+
+	return bot, opts, nil
+}
+
+// newFeedFilter returns the filter of fc, the filters fc does not set are taken from cfg.
+func newFeedFilter(fc FeedConfig, cfg Config) (itemFilter, error) {
+	include, exclude := fc.FilterInclude, fc.FilterExclude
+	if len(include) == 0 {
+		include = cfg.FilterInclude
+	}
+	if len(exclude) == 0 {
+		exclude = cfg.FilterExclude
+	}
+	return compileItemFilter(include, exclude,
+		orString(fc.FilterRegexInclude, cfg.FilterRegexInclude), orString(fc.FilterRegexExclude, cfg.FilterRegexExclude))
+}
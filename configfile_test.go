@@ -0,0 +1,79 @@
+package rss2telegram
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `feeds:
+  - url: https://example.com/feed.xml
+    chat_ids: ["@examplechannel", "-1001234567890"]
+    parse_mode: html
+  - url: https://example.org/rss
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	feeds, err := readConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 2 || feeds[0].URL != "https://example.com/feed.xml" || strings.Join(feeds[0].ChatIDs, ",") != "@examplechannel,-1001234567890" ||
+		feeds[0].ParseMode != "html" || feeds[1].URL != "https://example.org/rss" || len(feeds[1].ChatIDs) != 0 {
+		t.Errorf("readConfigFile() = %+v", feeds)
+	}
+}
+
+func TestReadConfigFileInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry string
+		want  string
+	}{
+		{"unknown field", "  - url: https://example.org/rss\n    chat_id: \"@examplechannel\"\n", "field chat_id not found"},
+		{"missing url", "  - chat_ids: [\"@examplechannel\"]\n", "no url"},
+		{"bad parse mode", "  - url: https://example.org/rss\n    parse_mode: markup\n", `unknown parse mode "markup"`},
+		{"bad chat id", "  - url: https://example.org/rss\n    chat_ids: [\"examplechannel\"]\n", `invalid chat id "examplechannel"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			// the invalid entry follows a valid one, so the error names the second feed
+			data := "feeds:\n  - url: https://example.com/feed.xml\n" + tt.entry
+			if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := readConfigFile(path)
+			if err == nil || !strings.Contains(err.Error(), "feed 2: ") || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("readConfigFile() error = %v, want an error of feed 2 containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFeedsJSONInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry string
+		want  string
+	}{
+		{"unknown field", `{"url": "https://example.org/rss", "chat_id": "@examplechannel"}`, `unknown field "chat_id"`},
+		{"missing url", `{"chat_ids": ["@examplechannel"]}`, "no url"},
+		{"bad parse mode", `{"url": "https://example.org/rss", "parse_mode": "markup"}`, `unknown parse mode "markup"`},
+		{"bad chat id", `{"url": "https://example.org/rss", "chat_ids": ["examplechannel"]}`, `invalid chat id "examplechannel"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseFeedsJSON(`[{"url": "https://example.com/feed.xml"}, ` + tt.entry + `]`)
+			if err == nil || !strings.Contains(err.Error(), "feed 2: ") || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseFeedsJSON() error = %v, want an error of feed 2 containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package rss2telegram
+
+import (
+	"context"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// renderDigest renders items as a single digest text, the title and the link of each item
+// on its own lines and items separated by blank lines, so the digest is split between items.
+func renderDigest(opts messageOptions, items []*gofeed.Item) string {
+	entries := make([]string, 0, len(items))
+	for _, item := range items {
+		var lines []string
+		if title := strings.Join(strings.Fields(opts.title(item)), " "); title != "" {
+			lines = append(lines, escapeText(opts.parseMode, title))
+		}
+		if link := opts.link(item); link != "" {
+			lines = append(lines, escapeText(opts.parseMode, link))
+		}
+		if len(lines) > 0 {
+			entries = append(entries, strings.Join(lines, "\n"))
+		}
+	}
+	if opts.hashtag != "" {
+		entries = append(entries, escapeText(opts.parseMode, opts.hashtag))
+	}
+	return opts.withHeader(strings.Join(entries, "\n\n"))
+}
+
+// sendDigest posts items to telegram chat chatID as a single digest message,
+// split into several messages if it exceeds telegram message length limit.
+// The digest is sent by the next bot of bot.pool.
+func sendDigest(ctx context.Context, bot telegramBot, chatID string, items []*gofeed.Item) error {
+	bot = bot.next()
+	for _, chunk := range splitMessage(renderDigest(bot.message, items), maxMessageLength, bot.message.parseMode) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := sendMessage(ctx, bot, chatID, chunk, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
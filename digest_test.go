@@ -0,0 +1,76 @@
+package rss2telegram
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestRenderDigest(t *testing.T) {
+	items := []*gofeed.Item{
+		{Title: "Go 1.22_rc *released* & <b>", Link: "https://example.com/go_1.22"},
+		{Title: "  Title on\n two lines ", Link: "https://example.com/2"},
+		{Title: "No link"},
+	}
+	tests := []struct {
+		parseMode string
+		want      string
+	}{
+		{parseModeMarkdown, "Go 1.22\\_rc \\*released\\* & <b>\nhttps://example.com/go\\_1.22\n\n" +
+			"Title on two lines\nhttps://example.com/2\n\nNo link\n\n#go\\_news"},
+		{parseModeMarkdownV2, "Go 1\\.22\\_rc \\*released\\* & <b\\>\nhttps://example\\.com/go\\_1\\.22\n\n" +
+			"Title on two lines\nhttps://example\\.com/2\n\nNo link\n\n\\#go\\_news"},
+		{parseModeHTML, "Go 1.22_rc *released* &amp; &lt;b&gt;\nhttps://example.com/go_1.22\n\n" +
+			"Title on two lines\nhttps://example.com/2\n\nNo link\n\n#go_news"},
+		{parseModeNone, "Go 1.22_rc *released* & <b>\nhttps://example.com/go_1.22\n\n" +
+			"Title on two lines\nhttps://example.com/2\n\nNo link\n\n#go_news"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.parseMode, func(t *testing.T) {
+			opts := testMessageOptions(t, tt.parseMode)
+			opts.hashtag = feedHashtag("go_news")
+
+			if got := renderDigest(opts, items); got != tt.want {
+				t.Errorf("renderDigest() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendDigestSplit(t *testing.T) {
+	tg := newTelegramServer(t)
+	bot := testBot(t, tg.URL, parseModeMarkdown)
+	var items []*gofeed.Item
+	for i := 1; i <= 100; i++ {
+		items = append(items, &gofeed.Item{Title: fmt.Sprintf("Item %d", i), Link: fmt.Sprintf("https://example.com/articles/%d/some-long-article-name", i)})
+	}
+
+	if err := sendDigest(context.Background(), bot, "1", items); err != nil {
+		t.Fatal(err)
+	}
+	sent := tg.sent()
+	if len(sent) < 2 {
+		t.Fatalf("sent %d messages, want the digest split into several", len(sent))
+	}
+	var n int
+	for _, r := range sent {
+		text := r.Params["text"]
+		if utf8.RuneCountInString(text) > maxMessageLength {
+			t.Errorf("message of %d characters exceeds the limit", utf8.RuneCountInString(text))
+		}
+		// the digest is split between items, so each message holds whole items in order
+		for _, entry := range strings.Split(text, "\n\n") {
+			n++
+			if want := fmt.Sprintf("Item %d\nhttps://example.com/articles/%d/some-long-article-name", n, n); entry != want {
+				t.Fatalf("entry %q, want %q", entry, want)
+			}
+		}
+	}
+	if n != len(items) {
+		t.Errorf("sent %d items, want %d", n, len(items))
+	}
+}
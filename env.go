@@ -0,0 +1,104 @@
+package rss2telegram
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envInt returns the value of the positive integer environment variable name,
+// or def if the variable is not set.
+func envInt(name string, def int) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("environment variable %s has invalid value %q", name, v)
+	}
+
+	return n, nil
+}
+
+// missingEnvError returns the error listing the names of missing required environment variables,
+// e.g. "environment variables RSS_FEED_URL, TELEGRAM_CHAT_ID not set". Returns nil if none are missing.
+func missingEnvError(names []string) error {
+	switch len(names) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("environment variable %s not set", names[0])
+	default:
+		return fmt.Errorf("environment variables %s not set", strings.Join(names, ", "))
+	}
+}
+
+// envCount returns the value of the non-negative integer environment variable name,
+// or def if the variable is not set.
+func envCount(name string, def int) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("environment variable %s has invalid value %q", name, v)
+	}
+
+	return n, nil
+}
+
+// envDuration returns the value of the positive duration environment variable name
+// (e.g. "500ms" or "2s"), or def if the variable is not set.
+func envDuration(name string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("environment variable %s has invalid value %q", name, v)
+	}
+
+	return d, nil
+}
+
+// envBool returns the value of the boolean environment variable name,
+// or def if the variable is not set.
+func envBool(name string, def bool) (bool, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("environment variable %s has invalid value %q", name, v)
+	}
+
+	return b, nil
+}
+
+// envTime returns the value of the time environment variable name in RFC3339 format,
+// or a date like "2006-01-02" meaning its midnight in UTC. Returns zero time if the variable is not set.
+func envTime(name string) (time.Time, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		if t, err = time.Parse("2006-01-02", v); err != nil {
+			return time.Time{}, fmt.Errorf("environment variable %s has invalid value %q", name, v)
+		}
+	}
+
+	return t, nil
+}
@@ -0,0 +1,94 @@
+package rss2telegram
+
+import "testing"
+
+func TestEnvCount(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"", 7, false},
+		{"0", 0, false},
+		{"3", 3, false},
+		{"-1", 0, true},
+		{"many", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("MAX_ITEMS_PER_RUN", tt.value)
+			got, err := envCount("MAX_ITEMS_PER_RUN", 7)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("envCount(%q) = %d, %v, want %d, error %v", tt.value, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigFromEnvZero(t *testing.T) {
+	tests := []struct {
+		name  string
+		value func(Config) int
+	}{
+		{"MAX_ITEMS_PER_RUN", func(cfg Config) int { return cfg.MaxItemsPerRun }},
+		{"MAX_CONTENT_CHARS", func(cfg Config) int { return cfg.MaxContentChars }},
+		{"MIN_ITEM_AGE_SECONDS", func(cfg Config) int { return int(cfg.MinItemAge) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("RSS_FEED_URL", "https://example.com/feed")
+			t.Setenv("TELEGRAM_BOT_API_TOKEN", "token")
+			t.Setenv("TELEGRAM_CHAT_ID", "1")
+			// 0 is the default, so setting it explicitly is valid
+			t.Setenv(tt.name, "0")
+
+			cfg, err := ConfigFromEnv()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.value(cfg); got != 0 {
+				t.Errorf("%s = %d, want 0", tt.name, got)
+			}
+		})
+	}
+}
+
+func TestConfigFromEnvMissing(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{
+			name: "all",
+			want: "environment variables RSS_FEED_URL, TELEGRAM_BOT_API_TOKEN, TELEGRAM_CHAT_ID not set",
+		},
+		{
+			name: "token and chat",
+			env:  map[string]string{"RSS_FEED_URL": "https://example.com/feed"},
+			want: "environment variables TELEGRAM_BOT_API_TOKEN, TELEGRAM_CHAT_ID not set",
+		},
+		{
+			name: "one",
+			env:  map[string]string{"RSS_FEED_URL": "https://example.com/feed", "TELEGRAM_BOT_API_TOKEN": "token"},
+			want: "environment variable TELEGRAM_CHAT_ID not set",
+		},
+		{
+			name: "feed without chats",
+			env:  map[string]string{"FEEDS_JSON": `[{"url": "https://example.com/feed"}]`},
+			want: "environment variables TELEGRAM_BOT_API_TOKEN, TELEGRAM_CHAT_ID (feed https://example.com/feed has no chat_ids) not set",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"RSS_FEED_URL", "TELEGRAM_BOT_API_TOKEN", "TELEGRAM_CHAT_ID", "CONFIG_FILE", "OPML_FILE", "FEEDS_JSON"} {
+				t.Setenv(name, tt.env[name])
+			}
+
+			_, err := ConfigFromEnv()
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("ConfigFromEnv() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
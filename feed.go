@@ -0,0 +1,213 @@
+package rss2telegram
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// maxRedirects is the maximum number of redirects followed by feed requests, as by default http client.
+const maxRedirects = 10
+
+// FeedCache holds the validators of a feed response used for conditional requests.
+type FeedCache struct {
+	ETag         string `firestore:"etag" json:"etag,omitempty"`
+	LastModified string `firestore:"lastModified" json:"lastModified,omitempty"`
+	// BodyHash is the hex SHA-256 hash of the feed body, so unchanged feeds of servers
+	// not supporting conditional requests are not processed either.
+	BodyHash string `firestore:"bodyHash" json:"bodyHash,omitempty"`
+}
+
+// fetchFeed retrieves and parses rssURL feed according to opts. If cache is set, the feed
+// is requested conditionally and nil feed is returned when it was not modified,
+// or when its body hashes to cache.BodyHash for servers responding with the whole feed anyway.
+// Returns the validators and the body hash of the response to cache for the next request.
+// Permanent redirects of the feed are logged, so the config can be updated.
+// Network errors, 5xx responses and feeds failed to be parsed are returned as transient errors.
+func fetchFeed(ctx context.Context, opts feedOptions, rssURL string, cache FeedCache) (*gofeed.Feed, FeedCache, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rssURL, nil)
+	if err != nil {
+		return nil, cache, err
+	}
+	req.Header.Set("User-Agent", opts.userAgent)
+	if opts.username != "" || opts.password != "" {
+		req.SetBasicAuth(opts.username, opts.password)
+	}
+	for name, value := range opts.headers {
+		req.Header.Set(name, value)
+	}
+	if cache.ETag != "" {
+		req.Header.Set("If-None-Match", cache.ETag)
+	}
+	if cache.LastModified != "" {
+		req.Header.Set("If-Modified-Since", cache.LastModified)
+	}
+
+	// the client is copied to record whether all redirects of this request are permanent
+	client := *opts.client
+	permanent := true
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		if code := req.Response.StatusCode; code != http.StatusMovedPermanently && code != http.StatusPermanentRedirect {
+			permanent = false
+		}
+		return nil
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, cache, transient(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	if finalURL := resp.Request.URL.String(); permanent && finalURL != rssURL {
+		// the state is still keyed by the configured url, so it is only reported
+		logger.Warn("feed moved permanently, update the feed url in the config", "feed_url", rssURL, "new_url", finalURL)
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, cache, nil
+	}
+	if resp.StatusCode < 200 || 300 <= resp.StatusCode {
+		err := fmt.Errorf("status code: %d", resp.StatusCode)
+		if resp.StatusCode >= 500 {
+			return nil, cache, transientError{err}
+		}
+		return nil, cache, err
+	}
+
+	body, err := decompressBody(resp.Body)
+	if err != nil {
+		return nil, cache, err
+	}
+
+	data, err := ioutil.ReadAll(&limitedReader{r: body, n: int64(opts.maxFeedBytes)})
+	if errors.Is(err, errFeedTooLarge) {
+		return nil, cache, err
+	}
+	if err != nil {
+		return nil, cache, transient(ctx, fmt.Errorf("reading feed: %v", err))
+	}
+
+	hash := sha256.Sum256(data)
+	newCache := FeedCache{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		BodyHash:     hex.EncodeToString(hash[:]),
+	}
+	if cache.BodyHash == newCache.BodyHash {
+		// the feed was not modified, though the server does not tell
+		return nil, newCache, nil
+	}
+
+	feed, err := parseFeed(bytes.NewReader(data))
+	if err != nil {
+		// the body may be truncated by the network, so the feed is fetched again
+		return nil, cache, transient(ctx, fmt.Errorf("parsing feed: %v", err))
+	}
+
+	return feed, newCache, nil
+}
+
+// newFeedParser returns gofeed parser keeping the <ttl> of RSS feeds and all authors of Atom entries.
+func newFeedParser() *gofeed.Parser {
+	p := gofeed.NewParser()
+	p.RSSTranslator = &ttlTranslator{}
+	p.AtomTranslator = &authorsTranslator{}
+	return p
+}
+
+// limitedReader reads from r failing with an error once more than n bytes are read,
+// unlike io.LimitReader which silently truncates the feed, so the parser reports a cryptic error.
+type limitedReader struct {
+	r io.Reader
+	// n is the number of bytes remaining to read.
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, errFeedTooLarge
+	}
+	if int64(len(p)) > l.n+1 {
+		// read one byte more than the limit to detect larger feeds
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, errFeedTooLarge
+	}
+	return n, err
+}
+
+// errFeedTooLarge is the error of reading a feed larger than the limit.
+var errFeedTooLarge = errors.New("feed exceeds the maximum size")
+
+// gzipMagic is the prefix of gzip-compressed data.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// decompressBody returns the reader of response body r, decompressing it if it is gzip-compressed.
+// Some servers send compressed feeds without Content-Encoding header, so the transport
+// does not decode them and the parser fails to detect the feed type.
+func decompressBody(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	prefix, _ := br.Peek(len(gzipMagic))
+	if !bytes.Equal(prefix, gzipMagic) {
+		return br, nil
+	}
+
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, fmt.Errorf("decompressing feed: %v", err)
+	}
+	return zr, nil
+}
+
+// normalizeFeedURL trims whitespace around feed url s and adds https scheme if it has none,
+// so common copy-paste mistakes do not fail with cryptic errors of the request.
+func normalizeFeedURL(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "://") {
+		s = "https://" + s
+	}
+
+	u, err := url.ParseRequestURI(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid feed url %q: %v", s, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("invalid feed url %q: scheme must be http or https", s)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid feed url %q: no host", s)
+	}
+
+	return s, nil
+}
+
+// normalizeFeedURLs returns feedURLs normalized with normalizeFeedURL.
+func normalizeFeedURLs(feedURLs []string) ([]string, error) {
+	normalized := make([]string, len(feedURLs))
+	for i, feedURL := range feedURLs {
+		var err error
+		if normalized[i], err = normalizeFeedURL(feedURL); err != nil {
+			return nil, err
+		}
+	}
+	return normalized, nil
+}
@@ -0,0 +1,448 @@
+package rss2telegram
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// oneItemFeed is RSS feed of a single item.
+const oneItemFeed = `<?xml version="1.0"?><rss version="2.0"><channel><title>Feed</title>` +
+	`<item><title>One</title><link>https://example.com/1</link></item></channel></rss>`
+
+func TestFetchFeedNotModified(t *testing.T) {
+	const etag, lastModified = `"v1"`, "Mon, 02 Jan 2006 15:04:05 GMT"
+	var notModified int
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag && r.Header.Get("If-Modified-Since") == lastModified {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		fmt.Fprint(w, oneItemFeed)
+	}))
+	defer feed.Close()
+	ctx := context.Background()
+
+	f, cache, err := fetchFeed(ctx, feedOptions{client: http.DefaultClient, maxFeedBytes: defaultMaxFeedBytes}, feed.URL, FeedCache{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f == nil || len(f.Items) != 1 {
+		t.Fatalf("feed = %v, want one item", f)
+	}
+	if cache.ETag != etag || cache.LastModified != lastModified {
+		t.Errorf("cache = %+v, want the validators of the feed", cache)
+	}
+
+	f, cache, err = fetchFeed(ctx, feedOptions{client: http.DefaultClient, maxFeedBytes: defaultMaxFeedBytes}, feed.URL, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f != nil {
+		t.Errorf("feed = %v, want nil when not modified", f)
+	}
+	if notModified != 1 {
+		t.Errorf("feed responded not modified %d times, want 1", notModified)
+	}
+	if cache.ETag != etag || cache.LastModified != lastModified {
+		t.Errorf("cache = %+v, want the validators kept", cache)
+	}
+}
+
+func TestFetchFeedBasicAuth(t *testing.T) {
+	const username, password = "reader", "s3cret-pa55"
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != username || p != password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="feed"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, oneItemFeed)
+	}))
+	defer feed.Close()
+
+	tests := []struct {
+		name     string
+		password string
+		ok       bool
+	}{
+		{"no credentials", "", false},
+		{"wrong password", "wr0ng-pa55", false},
+		{"credentials", password, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{FeedURLs: []string{feed.URL}, BotAPIToken: "token", ChatIDs: []string{"1"}}
+			if tt.password != "" {
+				cfg.FeedUsername, cfg.FeedPassword = username, tt.password
+			}
+			_, opts, err := cfg.settings()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			f, _, err := fetchFeed(context.Background(), opts, feed.URL, FeedCache{})
+			if !tt.ok && (err == nil || !strings.Contains(err.Error(), "401")) {
+				t.Errorf("fetchFeed() error = %v, want status code 401", err)
+			}
+			if tt.ok && (err != nil || len(f.Items) != 1) {
+				t.Fatalf("fetchFeed() = %v, %v, want one item", f, err)
+			}
+			if err != nil && tt.password != "" && strings.Contains(err.Error(), tt.password) {
+				t.Errorf("error %q contains the password", err)
+			}
+		})
+	}
+}
+
+func TestFetchFeedUserAgent(t *testing.T) {
+	var userAgent string
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.UserAgent()
+		fmt.Fprint(w, oneItemFeed)
+	}))
+	defer feed.Close()
+
+	for _, tt := range []struct{ name, userAgent, want string }{
+		{"default", "", defaultUserAgent},
+		{"custom", "Mozilla/5.0 (compatible; examplebot/1.0)", "Mozilla/5.0 (compatible; examplebot/1.0)"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{FeedURLs: []string{feed.URL}, BotAPIToken: "token", ChatIDs: []string{"1"}}
+			cfg.FeedUserAgent = tt.userAgent
+			_, opts, err := cfg.settings()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := fetchFeed(context.Background(), opts, feed.URL, FeedCache{}); err != nil {
+				t.Fatal(err)
+			}
+			if userAgent != tt.want {
+				t.Errorf("User-Agent = %q, want %q", userAgent, tt.want)
+			}
+		})
+	}
+}
+
+// gzipped returns data compressed with gzip.
+func gzipped(t *testing.T, data []byte) []byte {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestFeedGzipBody(t *testing.T) {
+	body := []byte(oneItemFeed)
+	tests := []struct {
+		name     string
+		body     []byte
+		encoding string
+	}{
+		{"plain", body, ""},
+		{"without content encoding", gzipped(t, body), ""},
+		{"mislabeled content encoding", gzipped(t, body), "identity"},
+		{"compressed twice", gzipped(t, gzipped(t, body)), "gzip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/rss+xml")
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				w.Write(tt.body)
+			}))
+			defer feed.Close()
+
+			f, _, err := fetchFeed(context.Background(), feedOptions{client: http.DefaultClient, maxFeedBytes: defaultMaxFeedBytes}, feed.URL, FeedCache{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(f.Items) != 1 || f.Items[0].Title != "One" {
+				t.Errorf("feed items = %v, want the item of the feed", f.Items)
+			}
+		})
+	}
+}
+
+func TestDecompressBodyInvalid(t *testing.T) {
+	// the magic number of gzip followed by an invalid header
+	_, err := decompressBody(bytes.NewReader([]byte{0x1f, 0x8b, 0x00}))
+	if err == nil || !strings.HasPrefix(err.Error(), "decompressing feed") {
+		t.Errorf("decompressBody() error = %v, want decompressing feed error", err)
+	}
+}
+
+func TestFetchFeedTooLarge(t *testing.T) {
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, oneItemFeed)
+	}))
+	defer feed.Close()
+
+	tests := []struct {
+		maxBytes int
+		wantErr  bool
+	}{
+		{len(oneItemFeed), false},
+		{len(oneItemFeed) / 2, true},
+	}
+	for _, tt := range tests {
+		_, _, err := fetchFeed(context.Background(), feedOptions{client: http.DefaultClient, maxFeedBytes: tt.maxBytes}, feed.URL, FeedCache{})
+		if tt.wantErr && (err == nil || !strings.Contains(err.Error(), errFeedTooLarge.Error()) || isTransient(err)) {
+			t.Errorf("fetchFeed() of %d bytes with limit %d error = %v, want %v", len(oneItemFeed), tt.maxBytes, err, errFeedTooLarge)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("fetchFeed() of %d bytes with limit %d error = %v", len(oneItemFeed), tt.maxBytes, err)
+		}
+	}
+}
+
+func TestFetchFeedRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		bodies   []string
+		requests int
+		wantErr  bool
+	}{
+		{"truncated once", []int{http.StatusOK}, []string{oneItemFeed[:len(oneItemFeed)/2], oneItemFeed}, 2, false},
+		{"truncated always", []int{http.StatusOK}, []string{oneItemFeed[:len(oneItemFeed)/2]}, 3, true},
+		{"server error once", []int{http.StatusServiceUnavailable, http.StatusOK}, []string{"unavailable", oneItemFeed}, 2, false},
+		{"server error always", []int{http.StatusBadGateway}, []string{"bad gateway"}, 3, true},
+		{"not found", []int{http.StatusNotFound, http.StatusOK}, []string{"not found", oneItemFeed}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+			feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				w.WriteHeader(tt.statuses[min(requests, len(tt.statuses))-1])
+				fmt.Fprint(w, tt.bodies[min(requests, len(tt.bodies))-1])
+			}))
+			defer feed.Close()
+			opts := feedOptions{client: http.DefaultClient, maxFeedBytes: defaultMaxFeedBytes}
+			retry := retryPolicy{maxRetries: 2, baseDelay: time.Millisecond}
+
+			var f *gofeed.Feed
+			err := retry.do(context.Background(), func() error {
+				var err error
+				f, _, err = fetchFeed(context.Background(), opts, feed.URL, FeedCache{})
+				return err
+			})
+			if tt.wantErr && err == nil {
+				t.Error("fetchFeed() succeeded, want an error")
+			}
+			if !tt.wantErr && (err != nil || len(f.Items) != 1) {
+				t.Errorf("fetchFeed() = %v, %v, want one item", f, err)
+			}
+			if requests != tt.requests {
+				t.Errorf("feed requested %d times, want %d", requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestFetchFeedRetryCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var requests int
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// the run is canceled while waiting for the retry
+		cancel()
+		fmt.Fprint(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>Feed`)
+	}))
+	defer feed.Close()
+	opts := feedOptions{client: http.DefaultClient, maxFeedBytes: defaultMaxFeedBytes}
+	retry := retryPolicy{maxRetries: 2, baseDelay: time.Hour}
+
+	start := time.Now()
+	err := retry.do(ctx, func() error {
+		_, _, err := fetchFeed(ctx, opts, feed.URL, FeedCache{})
+		return err
+	})
+	if err == nil {
+		t.Error("fetchFeed() succeeded, want an error")
+	}
+	if requests != 1 || time.Since(start) > 10*time.Second {
+		t.Errorf("feed requested %d times in %v, want once without waiting for the retry", requests, time.Since(start))
+	}
+}
+
+func TestFeedBodyHash(t *testing.T) {
+	now := time.Now()
+	body := rssFeed(
+		[3]string{"One", "https://example.com/1", rfc1123(now.Add(-2 * time.Hour))},
+		[3]string{"Two", "https://example.com/2", rfc1123(now.Add(-time.Hour))},
+	)
+	var requests int
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// no validators, so the feed is never requested conditionally
+		requests++
+		fmt.Fprint(w, body)
+	}))
+	defer feed.Close()
+	tg := newTelegramServer(t)
+	cfg := testConfig(t, tg.URL, "1", feed.URL)
+	ctx := context.Background()
+
+	if _, err := RunWithConfig(ctx, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(tg.sent()); got != 2 {
+		t.Fatalf("first run sent %d messages, want 2", got)
+	}
+
+	// the items are posted again if the feed is processed, since the cursor is moved back
+	if err := cfg.Store.WritePublishedAt(ctx, "1", feed.URL, now.Add(-24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := RunWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(tg.sent()); got != 2 || sum.ItemsFetched != 0 {
+		t.Errorf("second run of the same feed sent %d messages in total and fetched %d items, want 2 and 0", got, sum.ItemsFetched)
+	}
+	if requests != 2 {
+		t.Errorf("feed requested %d times, want 2", requests)
+	}
+
+	// a changed feed is processed
+	body = rssFeed([3]string{"Three", "https://example.com/3", rfc1123(now.Add(-time.Minute))})
+	if _, err := RunWithConfig(ctx, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(tg.sent()); got != 3 {
+		t.Errorf("run of the changed feed sent %d messages in total, want 3", got)
+	}
+}
+
+func TestFeedBodyHashFailedItems(t *testing.T) {
+	now := time.Now()
+	feed := newFeedServer(t, "application/rss+xml", rssFeed(
+		[3]string{"One", "https://example.com/1", rfc1123(now.Add(-time.Hour))},
+	))
+	tg := newTelegramServer(t)
+	tg.fail = func(r telegramRequest) int { return http.StatusBadRequest }
+	cfg := testConfig(t, tg.URL, "1", feed.URL)
+	ctx := context.Background()
+
+	if _, err := RunWithConfig(ctx, cfg); err != nil {
+		t.Fatal(err)
+	}
+	tg.mu.Lock()
+	tg.fail = nil
+	tg.mu.Unlock()
+
+	// the item failed, so the unchanged feed is processed again
+	if _, err := RunWithConfig(ctx, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(tg.sent()); got != 1 {
+		t.Errorf("sent %d messages, want the failed item sent on the next run", got)
+	}
+}
+
+func TestFeedNotModifiedItemsLeft(t *testing.T) {
+	now := time.Now()
+	body := rssFeed(
+		[3]string{"Two", "https://example.com/2", rfc1123(now.Add(-time.Hour))},
+		[3]string{"One", "https://example.com/1", rfc1123(now.Add(-2 * time.Hour))},
+	)
+	tests := []struct {
+		name     string
+		maxItems int
+		// failRuns is the number of the first runs failing to send.
+		failRuns int
+	}{
+		{"over the limit of the run", 1, 0},
+		{"failed to send", 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const etag = `"v1"`
+			var notModified int
+			feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("If-None-Match") == etag {
+					notModified++
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				w.Header().Set("ETag", etag)
+				fmt.Fprint(w, body)
+			}))
+			defer feed.Close()
+			tg := newTelegramServer(t)
+			cfg := testConfig(t, tg.URL, "1", feed.URL)
+			cfg.MaxItemsPerRun = tt.maxItems
+			ctx := context.Background()
+
+			for run := 0; run < 3; run++ {
+				tg.mu.Lock()
+				tg.fail = nil
+				if run < tt.failRuns {
+					tg.fail = func(r telegramRequest) int { return http.StatusBadRequest }
+				}
+				tg.mu.Unlock()
+				if _, err := RunWithConfig(ctx, cfg); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := len(tg.sent()); got != 2 {
+				t.Errorf("sent %d messages, want the items left by a run posted by the next ones", got)
+			}
+			if notModified != 1 {
+				t.Errorf("feed responded not modified %d times, want once all items were posted", notModified)
+			}
+		})
+	}
+}
+
+func TestFeedNotModifiedItemsNotSettled(t *testing.T) {
+	const etag = `"v1"`
+	var notModified int
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		fmt.Fprint(w, rssFeed([3]string{"One", "https://example.com/1", rfc1123(time.Now().Add(-time.Minute))}))
+	}))
+	defer feed.Close()
+	tg := newTelegramServer(t)
+	cfg := testConfig(t, tg.URL, "1", feed.URL)
+	cfg.MinItemAge = time.Hour
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := RunWithConfig(ctx, cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := len(tg.sent()); got != 0 {
+		t.Errorf("sent %d messages, want the item not settled yet left", got)
+	}
+	if notModified != 0 {
+		t.Errorf("feed responded not modified %d times, want it requested unconditionally while the item is left", notModified)
+	}
+}
@@ -0,0 +1,82 @@
+package rss2telegram
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// itemFilter selects feed items to post by keywords and patterns in the item title and content.
+type itemFilter struct {
+	// include keywords, if set an item must contain at least one of them.
+	include []string
+	// exclude keywords, an item must contain none of them.
+	exclude []string
+	// includeRegexp, if set, must match an item.
+	includeRegexp *regexp.Regexp
+	// excludeRegexp, if set, must not match an item.
+	excludeRegexp *regexp.Regexp
+}
+
+// newItemFilter returns itemFilter matching keywords case-insensitively.
+func newItemFilter(include, exclude []string) itemFilter {
+	return itemFilter{
+		include: lowerAll(include),
+		exclude: lowerAll(exclude),
+	}
+}
+
+// compileItemFilter returns itemFilter of keywords include and exclude and regular expressions
+// regexInclude and regexExclude, the empty ones are not applied.
+func compileItemFilter(include, exclude []string, regexInclude, regexExclude string) (itemFilter, error) {
+	var err error
+	filter := newItemFilter(include, exclude)
+	if filter.includeRegexp, err = compileRegexp(regexInclude); err != nil {
+		return itemFilter{}, fmt.Errorf("invalid include regular expression: %v", err)
+	}
+	if filter.excludeRegexp, err = compileRegexp(regexExclude); err != nil {
+		return itemFilter{}, fmt.Errorf("invalid exclude regular expression: %v", err)
+	}
+	return filter, nil
+}
+
+// match reports whether item passes the filter.
+func (f itemFilter) match(item *gofeed.Item) bool {
+	text := item.Title + "\n" + itemContent(item)
+
+	if f.excludeRegexp != nil && f.excludeRegexp.MatchString(text) {
+		return false
+	}
+	if f.includeRegexp != nil && !f.includeRegexp.MatchString(text) {
+		return false
+	}
+
+	text = strings.ToLower(text)
+
+	for _, keyword := range f.exclude {
+		if strings.Contains(text, keyword) {
+			return false
+		}
+	}
+
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, keyword := range f.include {
+		if strings.Contains(text, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// lowerAll returns list with all values in lower case.
+func lowerAll(list []string) []string {
+	lower := make([]string, len(list))
+	for i, v := range list {
+		lower[i] = strings.ToLower(v)
+	}
+	return lower
+}
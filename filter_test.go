@@ -0,0 +1,55 @@
+package rss2telegram
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestItemFilterRegexp(t *testing.T) {
+	items := []*gofeed.Item{
+		{Title: "Release v1.2.3", Content: "<p>Bug fixes.</p>"},
+		{Title: "Release notes", Content: "<p>Fixes JIRA-1234.</p>"},
+		{Title: "Weekly digest", Content: "<p>Nothing new.</p>"},
+	}
+	tests := []struct {
+		name             string
+		include, exclude string
+		want             []bool
+	}{
+		{"include title", `v\d+\.\d+\.\d+`, "", []bool{true, false, false}},
+		{"include content", `[A-Z]+-\d+`, "", []bool{false, true, false}},
+		{"exclude", "", `(?i)digest`, []bool{true, true, false}},
+		{"include and exclude", `(?i)^release`, `[A-Z]+-\d+`, []bool{true, false, false}},
+		{"none", "", "", []bool{true, true, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := newItemFilter(nil, nil)
+			if tt.include != "" {
+				filter.includeRegexp = regexp.MustCompile(tt.include)
+			}
+			if tt.exclude != "" {
+				filter.excludeRegexp = regexp.MustCompile(tt.exclude)
+			}
+			for i, item := range items {
+				if got := filter.match(item); got != tt.want[i] {
+					t.Errorf("match(%q) = %v, want %v", item.Title, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestItemFilterRegexpInvalid(t *testing.T) {
+	for _, exprs := range [][2]string{{"(", ""}, {"", "[a-"}} {
+		cfg := Config{FeedURLs: []string{"http://127.0.0.1/feed"}, BotAPIToken: "token", ChatIDs: []string{"1"}}
+		cfg.FilterRegexInclude, cfg.FilterRegexExclude = exprs[0], exprs[1]
+		_, _, err := cfg.settings()
+		if err == nil || !strings.HasPrefix(err.Error(), "config: invalid") {
+			t.Errorf("settings() with patterns %q error = %v, want invalid regular expression", exprs, err)
+		}
+	}
+}
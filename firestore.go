@@ -0,0 +1,474 @@
+package rss2telegram
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultCollection is the default firestore collection of telegram chat docs.
+const defaultCollection = "chats"
+
+var (
+	// projectID is set from the GCP_PROJECT environment variable, which is
+	// automatically set by the Cloud Functions runtime.
+	projectID = os.Getenv("GCP_PROJECT")
+	// client is a global Firestore client, initialized once per instance on first use.
+	client   *firestore.Client
+	clientMu sync.Mutex
+	// movedChatDocs are the paths of legacy chat docs already moved by chatDoc in this instance.
+	movedChatDocs sync.Map
+)
+
+// firestoreClient returns the global Firestore client, initializing it on the first call
+// so importing the package does not require credentials.
+func firestoreClient() (*firestore.Client, error) {
+	clientMu.Lock()
+	defer clientMu.Unlock()
+
+	if client != nil {
+		return client, nil
+	}
+
+	// client is initialized with context.Background() because it should
+	// persist between function invocations.
+	c, err := firestore.NewClient(context.Background(), projectID)
+	if err != nil {
+		return nil, fmt.Errorf("firestore.NewClient: %v", err)
+	}
+	client = c
+
+	return client, nil
+}
+
+// firestoreStore is Store keeping the state of each telegram chat in a doc of chats collection.
+type firestoreStore struct {
+	client *firestore.Client
+	chats  *firestore.CollectionRef
+}
+
+// seenField returns the field of chat doc the keys of items seen in dedup mode are stored in.
+func seenField(mode string) string {
+	if mode == dedupModeHash {
+		return "seenHashes"
+	}
+	return "seenGUIDs"
+}
+
+// ReadPublishedAt reads the time rssURL feed was published to telegram chat chatID from firestore.
+func (s firestoreStore) ReadPublishedAt(ctx context.Context, chatID, rssURL string) (time.Time, error) {
+	data, err := s.readFeedField(ctx, chatID, "publishedAt", rssURL)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	t, ok := data.(time.Time)
+	if !ok {
+		// data is not time.Time, return zero time.Time as a default value
+		return time.Time{}, nil
+	}
+
+	return t, nil
+}
+
+// WritePublishedAt writes the time rssURL feed was published to telegram chat chatID to firestore.
+func (s firestoreStore) WritePublishedAt(ctx context.Context, chatID, rssURL string, t time.Time) error {
+	return s.writeFeedField(ctx, chatID, "publishedAt", rssURL, t)
+}
+
+// ReadLastRunAt reads the time rssURL feed of telegram chat chatID was last processed from firestore.
+func (s firestoreStore) ReadLastRunAt(ctx context.Context, chatID, rssURL string) (time.Time, error) {
+	data, err := s.readFeedField(ctx, chatID, "lastRunAt", rssURL)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, _ := data.(time.Time)
+	return t, nil
+}
+
+// WriteLastRunAt writes the time rssURL feed of telegram chat chatID was last processed to firestore.
+func (s firestoreStore) WriteLastRunAt(ctx context.Context, chatID, rssURL string, t time.Time) error {
+	return s.writeFeedField(ctx, chatID, "lastRunAt", rssURL, t)
+}
+
+// ReadPostedLinks reads the times links were posted to telegram chat chatID by any feed
+// from postedLinks field of the chat doc.
+func (s firestoreStore) ReadPostedLinks(ctx context.Context, chatID string) (map[string]time.Time, error) {
+	doc, err := s.chatDoc(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	dsnap, err := doc.Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		// collection or doc not found, nothing was posted
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, _ := dsnap.Data()["postedLinks"].(map[string]interface{})
+	links := make(map[string]time.Time, len(data))
+	for link, v := range data {
+		if t, ok := v.(time.Time); ok {
+			links[link] = t
+		}
+	}
+	return links, nil
+}
+
+// WritePostedLinks replaces postedLinks field of telegram chat chatID doc with links.
+func (s firestoreStore) WritePostedLinks(ctx context.Context, chatID string, links map[string]time.Time) error {
+	doc, err := s.chatDoc(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	_, err = doc.Update(ctx, []firestore.Update{{FieldPath: []string{"postedLinks"}, Value: links}})
+	if status.Code(err) == codes.NotFound {
+		// collection or doc not found, create a doc
+		_, err = doc.Set(ctx, map[string]interface{}{"postedLinks": links})
+	}
+	return err
+}
+
+// ReadSeenKeys reads the GUIDs or hashes of rssURL feed items published to telegram chat chatID
+// in dedup mode from firestore.
+func (s firestoreStore) ReadSeenKeys(ctx context.Context, chatID, rssURL, mode string) ([]string, error) {
+	data, err := s.readFeedField(ctx, chatID, seenField(mode), rssURL)
+	if err != nil {
+		return nil, err
+	}
+
+	values, ok := data.([]interface{})
+	if !ok {
+		// data is not an array, return empty list as a default value
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(values))
+	for _, v := range values {
+		if key, ok := v.(string); ok {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+// WriteSeenKeys writes the GUIDs or hashes of rssURL feed items published to telegram chat chatID
+// in dedup mode to firestore.
+func (s firestoreStore) WriteSeenKeys(ctx context.Context, chatID, rssURL, mode string, keys []string) error {
+	return s.writeFeedField(ctx, chatID, seenField(mode), rssURL, keys)
+}
+
+// ReadFeedCache reads the validators of the last rssURL feed response of telegram chat chatID from firestore.
+func (s firestoreStore) ReadFeedCache(ctx context.Context, chatID, rssURL string) (FeedCache, error) {
+	data, err := s.readFeedField(ctx, chatID, "httpCache", rssURL)
+	if err != nil {
+		return FeedCache{}, err
+	}
+
+	m, ok := data.(map[string]interface{})
+	if !ok {
+		// data is not a map, return empty cache as a default value
+		return FeedCache{}, nil
+	}
+
+	var cache FeedCache
+	cache.ETag, _ = m["etag"].(string)
+	cache.LastModified, _ = m["lastModified"].(string)
+	cache.BodyHash, _ = m["bodyHash"].(string)
+
+	return cache, nil
+}
+
+// WriteFeedCache writes the validators of the last rssURL feed response of telegram chat chatID to firestore.
+func (s firestoreStore) WriteFeedCache(ctx context.Context, chatID, rssURL string, cache FeedCache) error {
+	return s.writeFeedField(ctx, chatID, "httpCache", rssURL, cache)
+}
+
+// ReadRevisions reads the last posted revisions of rssURL feed items of telegram chat chatID from firestore.
+func (s firestoreStore) ReadRevisions(ctx context.Context, chatID, rssURL string) (map[string]ItemRevision, error) {
+	data, err := s.readFeedField(ctx, chatID, "revisions", rssURL)
+	if err != nil {
+		return nil, err
+	}
+
+	m, ok := data.(map[string]interface{})
+	if !ok {
+		// data is not a map, return no revisions as a default value
+		return nil, nil
+	}
+
+	revisions := make(map[string]ItemRevision, len(m))
+	for guid, v := range m {
+		fields, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var rev ItemRevision
+		rev.UpdatedAt, _ = fields["updatedAt"].(time.Time)
+		if n, ok := fields["reposts"].(int64); ok {
+			rev.Reposts = int(n)
+		}
+		revisions[guid] = rev
+	}
+
+	return revisions, nil
+}
+
+// WriteRevisions writes the last posted revisions of rssURL feed items of telegram chat chatID to firestore.
+func (s firestoreStore) WriteRevisions(ctx context.Context, chatID, rssURL string, revisions map[string]ItemRevision) error {
+	return s.writeFeedField(ctx, chatID, "revisions", rssURL, revisions)
+}
+
+// Lock acquires the lock of rssURL feed of telegram chat chatID for lease in a transaction,
+// the owner and the expiry time of the lock are kept in locks field of the chat doc.
+func (s firestoreStore) Lock(ctx context.Context, chatID, rssURL string, lease time.Duration) (func(context.Context) error, bool, error) {
+	owner, err := lockOwner()
+	if err != nil {
+		return nil, false, err
+	}
+
+	doc, err := s.chatDoc(ctx, chatID)
+	if err != nil {
+		return nil, false, err
+	}
+	var acquired bool
+	err = s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		acquired = false
+		dsnap, err := tx.Get(doc)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			if data, err := dsnap.DataAtPath([]string{"locks", rssURL, "expiresAt"}); err == nil {
+				if expiresAt, ok := data.(time.Time); ok && time.Now().Before(expiresAt) {
+					// the lock is held by another run
+					return nil
+				}
+			}
+		}
+
+		acquired = true
+		return tx.Set(doc, map[string]interface{}{
+			"locks": map[string]interface{}{
+				rssURL: map[string]interface{}{"owner": owner, "expiresAt": time.Now().Add(lease)},
+			},
+		}, firestore.Merge([]string{"locks", rssURL}))
+	})
+	if err != nil || !acquired {
+		return nil, false, err
+	}
+
+	unlock := func(ctx context.Context) error {
+		return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			dsnap, err := tx.Get(doc)
+			if err != nil {
+				return err
+			}
+			if data, err := dsnap.DataAtPath([]string{"locks", rssURL, "owner"}); err != nil || data != owner {
+				// the lease expired and the lock was acquired by another run
+				return nil
+			}
+			return tx.Update(doc, []firestore.Update{{FieldPath: []string{"locks", rssURL}, Value: firestore.Delete}})
+		})
+	}
+
+	return unlock, true, nil
+}
+
+// messages returns the collection of docs of processed Pub/Sub messages, a sibling of chats collection.
+func (s firestoreStore) messages() *firestore.CollectionRef {
+	return s.client.Collection(s.chats.ID + "_messages")
+}
+
+// RecordMessage records message id in a doc of messages collection expiring after ttl. The doc is
+// created atomically, so only one of concurrent deliveries of the message records it.
+func (s firestoreStore) RecordMessage(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	doc := s.messages().Doc(id)
+	data := map[string]interface{}{"expiresAt": time.Now().Add(ttl)}
+
+	_, err := doc.Create(ctx, data)
+	if status.Code(err) != codes.AlreadyExists {
+		return err == nil, err
+	}
+
+	// the message was recorded before, it is processed again once the record expires
+	dsnap, err := doc.Get(ctx)
+	if err != nil {
+		return false, err
+	}
+	if expiresAt, ok := dsnap.Data()["expiresAt"].(time.Time); ok && time.Now().Before(expiresAt) {
+		return false, nil
+	}
+	// the precondition fails if a concurrent delivery renewed the record first
+	updates := []firestore.Update{{Path: "expiresAt", Value: data["expiresAt"]}}
+	_, err = doc.Update(ctx, updates, firestore.LastUpdateTime(dsnap.UpdateTime))
+	if status.Code(err) == codes.FailedPrecondition {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ForgetMessage deletes the doc of message id from messages collection.
+func (s firestoreStore) ForgetMessage(ctx context.Context, id string) error {
+	_, err := s.messages().Doc(id).Delete(ctx)
+	return err
+}
+
+// feedFields are the fields of chat doc holding the state of feeds keyed by feed url.
+var feedFields = []string{"publishedAt", "seenGUIDs", "seenHashes", "httpCache", "revisions", "locks", "lastRunAt"}
+
+// Ping reads a chat doc of the collection, an empty collection is not an error.
+func (s firestoreStore) Ping(ctx context.Context) error {
+	iter := s.chats.Limit(1).Documents(ctx)
+	defer iter.Stop()
+	if _, err := iter.Next(); err != nil && err != iterator.Done {
+		return err
+	}
+	return nil
+}
+
+// PruneCursors deletes the state of all feeds but keepFeedURLs from the docs of all telegram chats.
+// Docs modified since they were read are not updated, so the state of a concurrent run is not lost.
+func (s firestoreStore) PruneCursors(ctx context.Context, keepFeedURLs []string) (int, error) {
+	keep := feedSet(keepFeedURLs)
+
+	var n int
+	iter := s.chats.Documents(ctx)
+	defer iter.Stop()
+	for {
+		dsnap, err := iter.Next()
+		if err == iterator.Done {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+
+		var updates []firestore.Update
+		for _, field := range feedFields {
+			feeds, _ := dsnap.Data()[field].(map[string]interface{})
+			for feedURL := range feeds {
+				if !keep[feedURL] {
+					updates = append(updates, firestore.Update{FieldPath: []string{field, feedURL}, Value: firestore.Delete})
+				}
+			}
+		}
+		if len(updates) == 0 {
+			continue
+		}
+
+		if _, err := dsnap.Ref.Update(ctx, updates, firestore.LastUpdateTime(dsnap.UpdateTime)); err != nil {
+			return n, err
+		}
+		n += len(updates)
+	}
+}
+
+// readFeedField reads the value of rssURL feed in field of telegram chat chatID doc.
+// Returns nil value if the doc or the field does not exist.
+func (s firestoreStore) readFeedField(ctx context.Context, chatID, field, rssURL string) (interface{}, error) {
+	doc, err := s.chatDoc(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	dsnap, err := doc.Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		// collection or doc not found, feed was never published
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := dsnap.DataAtPath([]string{field, rssURL})
+	if err != nil {
+		// data at path not found, feed was never published
+		return nil, nil
+	}
+
+	return data, nil
+}
+
+// writeFeedField writes the value of rssURL feed in field of telegram chat chatID doc.
+func (s firestoreStore) writeFeedField(ctx context.Context, chatID, field, rssURL string, v interface{}) error {
+	doc, err := s.chatDoc(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	_, err = doc.Update(ctx, []firestore.Update{{
+		FieldPath: []string{field, rssURL},
+		Value:     v,
+	}})
+
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			// collection or doc not found, create a doc
+			_, err = doc.Set(ctx, map[string]interface{}{
+				field: map[string]interface{}{
+					rssURL: v,
+				},
+			})
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// chatDocID returns the id of firestore doc of telegram chat chatID.
+// Channel usernames are stored without the leading "@", numeric chat ids are kept as is.
+func chatDocID(chatID string) string {
+	return strings.Replace(strings.TrimPrefix(chatID, "@"), "/", "_", -1)
+}
+
+// chatDoc returns the firestore doc of telegram chat chatID. The state of channel usernames
+// stored in the doc with the username as is, before the leading "@" was stripped, is moved
+// to the doc of chatDocID on the first access, so the feeds of the channel are not posted again.
+func (s firestoreStore) chatDoc(ctx context.Context, chatID string) (*firestore.DocumentRef, error) {
+	doc := s.chats.Doc(chatDocID(chatID))
+	if doc.ID == chatID || strings.Contains(chatID, "/") {
+		// no legacy doc, the id is the same or was not a valid doc id
+		return doc, nil
+	}
+	legacy := s.chats.Doc(chatID)
+	if _, moved := movedChatDocs.Load(legacy.Path); moved {
+		return doc, nil
+	}
+
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if _, err := tx.Get(doc); status.Code(err) != codes.NotFound {
+			// the state is already stored in the new doc, or the error is returned
+			return err
+		}
+		dsnap, err := tx.Get(legacy)
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(doc, dsnap.Data()); err != nil {
+			return err
+		}
+		return tx.Delete(legacy)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("moving doc %s to %s: %v", legacy.ID, doc.ID, err)
+	}
+	movedChatDocs.Store(legacy.Path, true)
+	return doc, nil
+}
@@ -0,0 +1,184 @@
+package rss2telegram
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+func TestChatDocID(t *testing.T) {
+	tests := map[string]string{
+		"-1001234567890": "-1001234567890",
+		"42":             "42",
+		"@somechannel":   "somechannel",
+		"@some/channel":  "some_channel",
+	}
+	for chatID, want := range tests {
+		if got := chatDocID(chatID); got != want {
+			t.Errorf("chatDocID(%q) = %q, want %q", chatID, got, want)
+		}
+	}
+}
+
+// testFirestoreStore returns firestoreStore of a collection unique to the test in the firestore emulator
+// at FIRESTORE_EMULATOR_HOST, the test is skipped if it is not set.
+func testFirestoreStore(t *testing.T) firestoreStore {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST not set")
+	}
+	c, err := firestore.NewClient(context.Background(), "rss2telegram-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return firestoreStore{client: c, chats: c.Collection(t.Name() + time.Now().Format("150405.000000000"))}
+}
+
+func TestFirestoreChannelUsername(t *testing.T) {
+	s := testFirestoreStore(t)
+	ctx := context.Background()
+	publishedAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	if err := s.WritePublishedAt(ctx, "@somechannel", "https://example.com/feed", publishedAt); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.chats.Doc("somechannel").Get(ctx); err != nil {
+		t.Errorf("doc of @somechannel: %v", err)
+	}
+	got, err := s.ReadPublishedAt(ctx, "@somechannel", "https://example.com/feed")
+	if err != nil || !got.Equal(publishedAt) {
+		t.Errorf("ReadPublishedAt() = %v, %v, want %v", got, err, publishedAt)
+	}
+}
+
+func TestFirestoreLegacyChatDoc(t *testing.T) {
+	s := testFirestoreStore(t)
+	ctx := context.Background()
+	publishedAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	legacy := map[string]interface{}{
+		"publishedAt": map[string]interface{}{"https://example.com/feed": publishedAt},
+	}
+	if _, err := s.chats.Doc("@somechannel").Set(ctx, legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.ReadPublishedAt(ctx, "@somechannel", "https://example.com/feed")
+	if err != nil || !got.Equal(publishedAt) {
+		t.Errorf("ReadPublishedAt() = %v, %v, want the time of the legacy doc %v", got, err, publishedAt)
+	}
+	if _, err := s.chats.Doc("somechannel").Get(ctx); err != nil {
+		t.Errorf("doc of @somechannel: %v", err)
+	}
+	if _, err := s.chats.Doc("@somechannel").Get(ctx); err == nil {
+		t.Error("legacy doc of @somechannel not deleted")
+	}
+}
+
+func TestFirestoreLock(t *testing.T) {
+	s := testFirestoreStore(t)
+	ctx := context.Background()
+	const feedURL = "https://example.com/feed"
+
+	unlock, ok, err := s.Lock(ctx, "1", feedURL, time.Minute)
+	if err != nil || !ok {
+		t.Fatalf("Lock() = %v, %v, want the lock acquired", ok, err)
+	}
+	if _, ok, err := s.Lock(ctx, "1", feedURL, time.Minute); err != nil || ok {
+		t.Errorf("Lock() of a held lock = %v, %v, want false", ok, err)
+	}
+	if _, ok, err := s.Lock(ctx, "1", "https://example.com/other", time.Minute); err != nil || !ok {
+		t.Errorf("Lock() of another feed = %v, %v, want the lock acquired", ok, err)
+	}
+	if err := unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := s.Lock(ctx, "1", feedURL, time.Minute); err != nil || !ok {
+		t.Errorf("Lock() after unlock = %v, %v, want the lock acquired", ok, err)
+	}
+}
+
+func TestFirestoreLockConcurrent(t *testing.T) {
+	s := testFirestoreStore(t)
+	ctx := context.Background()
+
+	const runs = 10
+	var wg sync.WaitGroup
+	acquired := make(chan bool, runs)
+	for i := 0; i < runs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, ok, err := s.Lock(ctx, "1", "https://example.com/feed", time.Minute)
+			if err != nil {
+				t.Error(err)
+			}
+			acquired <- ok
+		}()
+	}
+	wg.Wait()
+	close(acquired)
+
+	var n int
+	for ok := range acquired {
+		if ok {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("%d of %d concurrent runs acquired the lock, want 1", n, runs)
+	}
+}
+
+func TestFirestoreConcurrentRuns(t *testing.T) {
+	s := testFirestoreStore(t)
+	now := time.Now()
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprintf(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>Feed</title>`+
+			`<item><title>Two</title><link>https://example.com/2</link><pubDate>%s</pubDate></item>`+
+			`<item><title>One</title><link>https://example.com/1</link><pubDate>%s</pubDate></item></channel></rss>`,
+			now.Add(-time.Hour).Format(time.RFC1123Z), now.Add(-2*time.Hour).Format(time.RFC1123Z))
+	}))
+	defer feed.Close()
+	var sent int32
+	tg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// slow sends keep the lock held while the other run starts
+		time.Sleep(100 * time.Millisecond)
+		atomic.AddInt32(&sent, 1)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer tg.Close()
+	cfg := Config{
+		FeedURLs:           []string{feed.URL},
+		BotAPIToken:        "token",
+		APIBaseURL:         tg.URL,
+		ChatIDs:            []string{"1"},
+		BackfillOnFirstRun: true,
+		Store:              s,
+	}
+
+	// like two deliveries of the same Pub/Sub event
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := RunWithConfig(context.Background(), cfg); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&sent); got != 2 {
+		t.Errorf("concurrent runs sent %d messages, want each item sent once", got)
+	}
+}
@@ -0,0 +1,71 @@
+package rss2telegram
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Pinger is implemented by stores able to check their connectivity without changing the state of chats.
+type Pinger interface {
+	// Ping makes a trivial read of the store.
+	Ping(ctx context.Context) error
+}
+
+// CheckHealth verifies the telegram bot tokens of cfg by calling getMe and the connectivity
+// of the store of cfg if it is Pinger, so misconfiguration is caught before feeds stop being posted.
+// Nothing is posted and the state of chats is not changed.
+func CheckHealth(ctx context.Context, cfg Config) error {
+	bot, _, err := cfg.botSettings()
+	if err != nil {
+		return err
+	}
+	// any bot of the pool may post an item, so each token is verified
+	for _, b := range bot.all() {
+		if err := validateBot(ctx, b, nil); err != nil {
+			return err
+		}
+	}
+
+	store, err := cfg.store()
+	if err != nil {
+		return err
+	}
+	if pinger, ok := store.(Pinger); ok {
+		if err := pinger.Ping(ctx); err != nil {
+			return fmt.Errorf("store: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// serveHealth responds to health checks of uptime monitors with 200 status code if CheckHealth
+// of the config of environment variables succeeds, otherwise with 503 status code and the error.
+func serveHealth(w http.ResponseWriter, r *http.Request) {
+	var resp struct {
+		Status string `json:"status"`
+		Error  string `json:"error,omitempty"`
+	}
+
+	cfg, err := ConfigFromEnv()
+	if err == nil {
+		err = CheckHealth(r.Context(), cfg)
+	}
+
+	resp.Status = "ok"
+	code := http.StatusOK
+	if err != nil {
+		logger.Error("health check failed", "error", err)
+		resp.Status = "failed"
+		resp.Error = err.Error()
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Error("writing response", "error", err)
+	}
+}
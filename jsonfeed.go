@@ -0,0 +1,195 @@
+package rss2telegram
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+)
+
+// jsonFeed is a feed of JSON Feed format (https://jsonfeed.org), versions 1 and 1.1.
+type jsonFeed struct {
+	Version     string       `json:"version"`
+	Title       string       `json:"title"`
+	HomePageURL string       `json:"home_page_url"`
+	FeedURL     string       `json:"feed_url"`
+	Description string       `json:"description"`
+	Icon        string       `json:"icon"`
+	Favicon     string       `json:"favicon"`
+	Language    string       `json:"language"`
+	Author      *jsonAuthor  `json:"author"`
+	Authors     []jsonAuthor `json:"authors"`
+	Items       []jsonItem   `json:"items"`
+}
+
+// jsonItem is an item of JSON Feed.
+type jsonItem struct {
+	ID            json.RawMessage  `json:"id"`
+	URL           string           `json:"url"`
+	ExternalURL   string           `json:"external_url"`
+	Title         string           `json:"title"`
+	ContentHTML   string           `json:"content_html"`
+	ContentText   string           `json:"content_text"`
+	Summary       string           `json:"summary"`
+	Image         string           `json:"image"`
+	BannerImage   string           `json:"banner_image"`
+	DatePublished string           `json:"date_published"`
+	DateModified  string           `json:"date_modified"`
+	Author        *jsonAuthor      `json:"author"`
+	Authors       []jsonAuthor     `json:"authors"`
+	Tags          []string         `json:"tags"`
+	Attachments   []jsonAttachment `json:"attachments"`
+}
+
+// jsonAuthor is an author of JSON Feed or its item.
+type jsonAuthor struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// jsonAttachment is an attachment of JSON Feed item.
+type jsonAttachment struct {
+	URL         string `json:"url"`
+	MimeType    string `json:"mime_type"`
+	SizeInBytes int64  `json:"size_in_bytes"`
+}
+
+// parseFeed parses the feed of r, JSON Feeds are detected by their leading "{"
+// and parsed by parseJSONFeed, other feeds are parsed by the parser of newFeedParser.
+func parseFeed(r io.Reader) (*gofeed.Feed, error) {
+	br := bufio.NewReader(r)
+	for {
+		b, err := br.Peek(1)
+		if err != nil || strings.IndexByte(" \t\r\n", b[0]) < 0 {
+			break
+		}
+		br.Discard(1)
+	}
+	if b, err := br.Peek(1); err == nil && b[0] == '{' {
+		return parseJSONFeed(br)
+	}
+	return newFeedParser().Parse(br)
+}
+
+// parseJSONFeed parses JSON Feed of r to gofeed.Feed. The html content of items is preferred
+// over their text content, which is escaped to HTML with line breaks kept.
+// Items without authors of their own are attributed to the authors of the feed.
+func parseJSONFeed(r io.Reader) (*gofeed.Feed, error) {
+	var f jsonFeed
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("parsing json feed: %v", err)
+	}
+	if !strings.HasPrefix(f.Version, "https://jsonfeed.org/version/") {
+		return nil, fmt.Errorf("parsing json feed: unknown version %q", f.Version)
+	}
+
+	feed := &gofeed.Feed{
+		Title:       f.Title,
+		Description: f.Description,
+		Link:        f.HomePageURL,
+		FeedLink:    f.FeedURL,
+		Language:    f.Language,
+		FeedType:    "json",
+		FeedVersion: strings.TrimPrefix(f.Version, "https://jsonfeed.org/version/"),
+	}
+	if icon := orString(f.Icon, f.Favicon); icon != "" {
+		feed.Image = &gofeed.Image{URL: icon}
+	}
+	feedAuthors := jsonAuthorNames(f.Author, f.Authors)
+	if len(feedAuthors) > 0 {
+		feed.Author = &gofeed.Person{Name: feedAuthors[0]}
+	}
+
+	for _, it := range f.Items {
+		item := &gofeed.Item{
+			GUID:        jsonItemID(it.ID),
+			Link:        orString(it.URL, it.ExternalURL),
+			Title:       it.Title,
+			Content:     it.ContentHTML,
+			Description: it.Summary,
+			Published:   it.DatePublished,
+			Updated:     it.DateModified,
+			Categories:  it.Tags,
+		}
+		if item.Content == "" && it.ContentText != "" {
+			item.Content = textToHTML(it.ContentText)
+		}
+		if image := orString(it.Image, it.BannerImage); image != "" {
+			item.Image = &gofeed.Image{URL: image}
+		}
+		if t, err := time.Parse(time.RFC3339, it.DatePublished); err == nil {
+			item.PublishedParsed = &t
+		}
+		if t, err := time.Parse(time.RFC3339, it.DateModified); err == nil {
+			item.UpdatedParsed = &t
+		}
+
+		authors := jsonAuthorNames(it.Author, it.Authors)
+		if len(authors) == 0 {
+			authors = feedAuthors
+		}
+		if len(authors) > 0 {
+			item.Author = &gofeed.Person{Name: authors[0]}
+		}
+		if len(authors) > 1 {
+			// the rest of the authors are listed as creators, as in RSS feeds with several of them
+			item.DublinCoreExt = &ext.DublinCoreExtension{Creator: authors}
+		}
+
+		for _, a := range it.Attachments {
+			e := &gofeed.Enclosure{URL: a.URL, Type: a.MimeType}
+			if a.SizeInBytes > 0 {
+				e.Length = strconv.FormatInt(a.SizeInBytes, 10)
+			}
+			item.Enclosures = append(item.Enclosures, e)
+		}
+
+		feed.Items = append(feed.Items, item)
+	}
+
+	return feed, nil
+}
+
+// jsonAuthorNames returns the names of the authors of version 1.1 falling back to the author of version 1.
+func jsonAuthorNames(author *jsonAuthor, authors []jsonAuthor) []string {
+	if len(authors) == 0 && author != nil {
+		authors = []jsonAuthor{*author}
+	}
+	var names []string
+	for _, a := range authors {
+		if a.Name != "" {
+			names = append(names, a.Name)
+		}
+	}
+	return names
+}
+
+// jsonItemID returns the id of JSON Feed item, which is a string but is a number in some feeds.
+func jsonItemID(id json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(id, &s); err == nil {
+		return s
+	}
+	return string(id)
+}
+
+// paragraphBreaks matches the blank lines separating paragraphs of plain text.
+var paragraphBreaks = regexp.MustCompile(`\n[ \t]*\n\s*`)
+
+// textToHTML escapes plain text s to HTML, its paragraphs separated by blank lines are wrapped
+// in <p> tags and the rest of line breaks are kept as <br> tags.
+func textToHTML(s string) string {
+	var b strings.Builder
+	for _, p := range paragraphBreaks.Split(strings.Replace(strings.TrimSpace(s), "\r\n", "\n", -1), -1) {
+		b.WriteString("<p>" + strings.Replace(html.EscapeString(p), "\n", "<br>", -1) + "</p>")
+	}
+	return b.String()
+}
@@ -0,0 +1,111 @@
+package rss2telegram
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseJSONFeed(t *testing.T) {
+	f, err := os.Open("testdata/jsonfeed.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	feed, err := parseFeed(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.Title != "Example Blog" || feed.FeedType != "json" || feed.FeedVersion != "1.1" {
+		t.Errorf("feed = %q of type %s %s, want Example Blog of json 1.1", feed.Title, feed.FeedType, feed.FeedVersion)
+	}
+	if feed.Image == nil || feed.Image.URL != "https://example.org/icon-512.png" {
+		t.Errorf("feed image = %+v, want the icon", feed.Image)
+	}
+	if len(feed.Items) != 3 {
+		t.Fatalf("%d items, want 3", len(feed.Items))
+	}
+
+	release, notes, screenshot := feed.Items[0], feed.Items[1], feed.Items[2]
+	if want := `<p>Version <b>2.0</b> is out, see <a href="https://example.org/changelog">the changelog</a>.</p>`; release.Content != want {
+		t.Errorf("content = %q, want content_html %q", release.Content, want)
+	}
+	if got := strings.Join(itemAuthors(release), ", "); got != "Jane Doe, John Roe" {
+		t.Errorf("authors = %q, want Jane Doe, John Roe", got)
+	}
+	published := time.Date(2024, 3, 2, 15, 0, 0, 0, time.UTC)
+	if release.PublishedParsed == nil || !release.PublishedParsed.Equal(published) {
+		t.Errorf("published = %v, want %v", release.PublishedParsed, published)
+	}
+	if strings.Join(release.Categories, ",") != "release,changelog" {
+		t.Errorf("categories = %v, want the tags", release.Categories)
+	}
+
+	if want := "<p>First line &lt;of&gt; text<br>second line &amp; more.</p><p>Second paragraph.</p>"; notes.Content != want {
+		t.Errorf("content = %q, want content_text escaped to %q", notes.Content, want)
+	}
+	if notes.GUID != "1709200000" {
+		t.Errorf("guid = %q, want the numeric id", notes.GUID)
+	}
+	if got := strings.Join(itemAuthors(notes), ", "); got != "Jane Doe" {
+		t.Errorf("authors = %q, want the author of the feed", got)
+	}
+
+	if screenshot.Link != "https://images.example.net/screenshot" {
+		t.Errorf("link = %q, want external_url", screenshot.Link)
+	}
+	if screenshot.Image == nil || screenshot.Image.URL != "https://example.org/images/screenshot.png" {
+		t.Errorf("image = %+v, want the image of the item", screenshot.Image)
+	}
+	if got := strings.Join(itemAuthors(screenshot), ", "); got != "Guest Writer" {
+		t.Errorf("authors = %q, want the version 1 author", got)
+	}
+}
+
+func TestFetchJSONFeed(t *testing.T) {
+	data, err := os.ReadFile("testdata/jsonfeed.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/feed+json")
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	feed, _, err := fetchFeed(context.Background(), feedOptions{client: http.DefaultClient, maxFeedBytes: defaultMaxFeedBytes}, srv.URL, FeedCache{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := chronological(feed.Items)
+	if len(items) != 3 {
+		t.Fatalf("feed has %d items, want 3", len(items))
+	}
+	opts := testMessageOptions(t, parseModeHTML)
+	opts.includeAuthor = true
+	var texts []string
+	for _, item := range items {
+		text, err := renderMessage(opts, item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		texts = append(texts, text)
+	}
+
+	// the items are posted from older to newer
+	if itemImage(items[0]) != "https://example.org/images/screenshot.png" ||
+		!strings.HasPrefix(texts[0], "<b>Screenshot</b>\nby Guest Writer\n\nThe new look.") {
+		t.Errorf("first message = %q, want the photo of the screenshot item", texts[0])
+	}
+	if want := "<b>Plain text notes</b>\nby Jane Doe\n\nFirst line &lt;of&gt; text\nsecond line &amp; more.\n\nSecond paragraph."; !strings.HasPrefix(texts[1], want) {
+		t.Errorf("second message = %q, want %q", texts[1], want)
+	}
+	if want := `<b>Release notes</b>` + "\nby Jane Doe, John Roe\n\n" + `Version <b>2.0</b> is out, see <a href="https://example.org/changelog">the changelog</a>.`; !strings.HasPrefix(texts[2], want) {
+		t.Errorf("third message = %q, want %q", texts[2], want)
+	}
+}
@@ -0,0 +1,87 @@
+package rss2telegram
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// RunRecorder is implemented by stores recording the time each feed of a chat was last processed
+// successfully, so external monitors can alert on feeds that stopped being processed.
+// Unlike the published time of the feed, it moves forward on runs without new items.
+type RunRecorder interface {
+	// ReadLastRunAt returns the time feedURL of chatID was last processed, zero if it never was.
+	ReadLastRunAt(ctx context.Context, chatID, feedURL string) (time.Time, error)
+	// WriteLastRunAt stores the time feedURL of chatID was last processed.
+	WriteLastRunAt(ctx context.Context, chatID, feedURL string, t time.Time) error
+}
+
+// FeedStatus is the status of a feed of a chat.
+type FeedStatus struct {
+	FeedURL string `json:"feedUrl"`
+	ChatID  string `json:"chatId"`
+	// LastRunAt is the time the feed was last processed successfully, nil if it never was.
+	LastRunAt *time.Time `json:"lastRunAt"`
+}
+
+// FeedStatuses returns the statuses of all feeds of cfg in all their chats.
+// The last run times are read from the store of cfg if it is RunRecorder, otherwise they are nil.
+func FeedStatuses(ctx context.Context, cfg Config) ([]FeedStatus, error) {
+	bot, opts, err := cfg.settings()
+	if err != nil {
+		return nil, err
+	}
+	routes, err := cfg.routes(bot, opts)
+	if err != nil {
+		return nil, err
+	}
+	store, err := cfg.store()
+	if err != nil {
+		return nil, err
+	}
+
+	recorder, _ := store.(RunRecorder)
+	statuses := make([]FeedStatus, 0, len(routes))
+	for _, r := range routes {
+		status := FeedStatus{FeedURL: r.feedURL, ChatID: r.chatID}
+		if recorder != nil {
+			t, err := recorder.ReadLastRunAt(ctx, r.chatID, r.feedURL)
+			if err != nil {
+				return nil, err
+			}
+			if !t.IsZero() {
+				status.LastRunAt = &t
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// serveStatus responds with JSON of FeedStatuses of the config of environment variables
+// without running, with 500 status code and the error if they could not be read.
+func serveStatus(w http.ResponseWriter, r *http.Request) {
+	var resp struct {
+		Feeds []FeedStatus `json:"feeds"`
+		Error string       `json:"error,omitempty"`
+	}
+
+	cfg, err := ConfigFromEnv()
+	if err == nil {
+		resp.Feeds, err = FeedStatuses(r.Context(), cfg)
+	}
+
+	code := http.StatusOK
+	if err != nil {
+		logger.Error("reading feed statuses", "error", err)
+		resp.Error = err.Error()
+		code = http.StatusInternalServerError
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Error("writing response", "error", err)
+	}
+}
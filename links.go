@@ -0,0 +1,60 @@
+package rss2telegram
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// defaultTrackingParams are the query parameters stripped from links by default,
+// a trailing "*" matches any parameter with the prefix.
+var defaultTrackingParams = []string{
+	"utm_*", "fbclid", "gclid", "dclid", "msclkid", "yclid", "igshid",
+	"mc_cid", "mc_eid", "_hsenc", "_hsmi", "mkt_tok",
+}
+
+// stripTrackingParams removes query parameters matching params from link.
+// The order of the rest of parameters is kept, link is returned as is if it can't be parsed.
+func stripTrackingParams(link string, params []string) string {
+	u, err := url.Parse(link)
+	if err != nil || u.RawQuery == "" {
+		return link
+	}
+
+	var kept []string
+	for _, pair := range strings.Split(u.RawQuery, "&") {
+		key := pair
+		if i := strings.IndexByte(pair, '='); i >= 0 {
+			key = pair[:i]
+		}
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+		if !matchParam(key, params) {
+			kept = append(kept, pair)
+		}
+	}
+
+	u.RawQuery = strings.Join(kept, "&")
+	return u.String()
+}
+
+// matchParam reports whether query parameter key matches any of params.
+func matchParam(key string, params []string) bool {
+	for _, p := range params {
+		if strings.HasSuffix(p, "*") && strings.HasPrefix(key, strings.TrimSuffix(p, "*")) || key == p {
+			return true
+		}
+	}
+	return false
+}
+
+// textURL matches urls in a text.
+var textURL = regexp.MustCompile(`https?://[^\s()<>\[\]"'` + "`" + `]+`)
+
+// stripTrackingParamsInText removes query parameters matching params from all urls in text.
+func stripTrackingParamsInText(text string, params []string) string {
+	return textURL.ReplaceAllStringFunc(text, func(link string) string {
+		return stripTrackingParams(link, params)
+	})
+}
@@ -0,0 +1,29 @@
+package rss2telegram
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// defaultLockLease is the default time a feed of a chat stays locked by a run that did not unlock it,
+// e.g. because it crashed. It exceeds the maximum timeout of cloud functions.
+const defaultLockLease = 10 * time.Minute
+
+// Locker is implemented by stores able to lock a feed of a chat, so concurrent runs
+// (e.g. of a Pub/Sub event delivered twice) do not post the same items twice.
+type Locker interface {
+	// Lock acquires the lock of feedURL of chatID for lease, reports false if it is held by another run.
+	// The returned unlock releases the lock unless the lease expired and it was acquired by another run.
+	Lock(ctx context.Context, chatID, feedURL string, lease time.Duration) (unlock func(context.Context) error, ok bool, err error)
+}
+
+// lockOwner returns a random id of the owner of a lock.
+func lockOwner() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
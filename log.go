@@ -0,0 +1,36 @@
+package rss2telegram
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/mmcdole/gofeed"
+)
+
+var (
+	// logLevel is the minimum level of logged events, set from Config.LogLevel on each run.
+	logLevel = new(slog.LevelVar)
+	// logger writes JSON logs to stderr, structured for Cloud Logging.
+	logger = slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel}))
+)
+
+// parseLogLevel returns the log level named s ("debug", "info", "warn" or "error"),
+// defaulting to info if s is empty.
+func parseLogLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	err := level.UnmarshalText([]byte(s))
+	return level, err
+}
+
+// feedLogger returns the logger of events of rssFeedURL feed posted to telegram chat chatID.
+func feedLogger(rssFeedURL, chatID string) *slog.Logger {
+	return logger.With("feed_url", rssFeedURL, "chat_id", chatID)
+}
+
+// itemLogger returns the logger of events of item of rssFeedURL feed posted to telegram chat chatID.
+func itemLogger(rssFeedURL, chatID string, item *gofeed.Item) *slog.Logger {
+	return feedLogger(rssFeedURL, chatID).With("item_guid", itemGUID(item))
+}
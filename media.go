@@ -0,0 +1,138 @@
+package rss2telegram
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// maxURLFileSize is the maximum size of a file telegram can send by url.
+const maxURLFileSize = 50 << 20
+
+// videoTypes are the types of video enclosures telegram can send by url.
+var videoTypes = map[string]bool{"video/mp4": true}
+
+// documentTypes are the types of document enclosures telegram can send by url.
+var documentTypes = map[string]bool{"application/pdf": true, "application/zip": true}
+
+// itemEnclosure returns the first enclosure of item of media type kind, e.g. "audio",
+// or nil if item has none.
+func itemEnclosure(item *gofeed.Item, kind string) *gofeed.Enclosure {
+	for _, e := range item.Enclosures {
+		if strings.HasPrefix(e.Type, kind+"/") && e.URL != "" {
+			return e
+		}
+	}
+	return nil
+}
+
+// itemDocument returns the first enclosure of item that is not a video, an audio or an image,
+// or nil if item has none.
+func itemDocument(item *gofeed.Item) *gofeed.Enclosure {
+	for _, e := range item.Enclosures {
+		if e.URL == "" || strings.HasPrefix(e.Type, "video/") || strings.HasPrefix(e.Type, "audio/") || strings.HasPrefix(e.Type, "image/") {
+			continue
+		}
+		if e.Type == "" && hasImageExt(e.URL) {
+			// images without a type are posted as photos
+			continue
+		}
+		return e
+	}
+	return nil
+}
+
+// tooLargeForURL reports whether enclosure e is known to exceed the size of a file
+// telegram can send by url.
+func tooLargeForURL(e *gofeed.Enclosure) bool {
+	n, err := strconv.ParseInt(e.Length, 10, 64)
+	return err == nil && n > maxURLFileSize
+}
+
+// itemImage returns the url of the first image of item found in the item image, an <img> tag
+// of the item content or description, an image enclosure or a Media RSS image, in that order.
+// Returns empty string if item has no image.
+func itemImage(item *gofeed.Item) string {
+	if item.Image != nil && item.Image.URL != "" {
+		return item.Image.URL
+	}
+
+	if image := firstImageSrc(itemContent(item)); image != "" {
+		return image
+	}
+
+	for _, e := range item.Enclosures {
+		if e.URL != "" && (strings.HasPrefix(e.Type, "image/") || e.Type == "" && hasImageExt(e.URL)) {
+			return e.URL
+		}
+	}
+
+	return mediaImage(item)
+}
+
+// imageExts are the extensions of image files posted as photos.
+var imageExts = []string{".jpg", ".jpeg", ".png", ".gif", ".webp"}
+
+// hasImageExt reports whether the path of url u has an image file extension,
+// for enclosures of photo feeds without a type.
+func hasImageExt(u string) bool {
+	if i := strings.IndexAny(u, "?#"); i >= 0 {
+		u = u[:i]
+	}
+	u = strings.ToLower(u)
+	for _, e := range imageExts {
+		if strings.HasSuffix(u, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// mediaImage returns the url of the first image of Media RSS extension of item,
+// a media:content of image medium or type or a media:thumbnail, either of them grouped in media:group.
+func mediaImage(item *gofeed.Item) string {
+	media := item.Extensions["media"]
+	contents := append([]ext.Extension(nil), media["content"]...)
+	thumbnails := append([]ext.Extension(nil), media["thumbnail"]...)
+	for _, group := range media["group"] {
+		contents = append(contents, group.Children["content"]...)
+		thumbnails = append(thumbnails, group.Children["thumbnail"]...)
+	}
+
+	for _, c := range contents {
+		if c.Attrs["url"] != "" && (c.Attrs["medium"] == "image" || strings.HasPrefix(c.Attrs["type"], "image/")) {
+			return c.Attrs["url"]
+		}
+	}
+	for _, t := range thumbnails {
+		if t.Attrs["url"] != "" {
+			return t.Attrs["url"]
+		}
+	}
+	return ""
+}
+
+// firstImageSrc returns the src attribute of the first <img> tag in HTML s.
+func firstImageSrc(s string) string {
+	z := xhtml.NewTokenizer(strings.NewReader(s))
+	for {
+		switch z.Next() {
+		case xhtml.ErrorToken:
+			return ""
+		case xhtml.StartTagToken, xhtml.SelfClosingTagToken:
+			t := z.Token()
+			if t.DataAtom != atom.Img {
+				continue
+			}
+			for _, a := range t.Attr {
+				if a.Key == "src" && strings.HasPrefix(a.Val, "http") {
+					return a.Val
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package rss2telegram
+
+import (
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+)
+
+func TestItemImage(t *testing.T) {
+	image := &gofeed.Image{URL: "https://example.com/image.png"}
+	content := `<p>Text <img src="https://example.com/inline.png"></p>`
+	enclosure := &gofeed.Enclosure{URL: "https://example.com/enclosure.png", Type: "image/png"}
+	media := ext.Extensions{"media": {"thumbnail": {{Name: "thumbnail", Attrs: map[string]string{"url": "https://example.com/media.png"}}}}}
+
+	tests := []struct {
+		name string
+		item *gofeed.Item
+		want string
+	}{
+		{"item image", &gofeed.Item{Image: image, Content: content, Enclosures: []*gofeed.Enclosure{enclosure}, Extensions: media}, image.URL},
+		{"inline image", &gofeed.Item{Content: content, Enclosures: []*gofeed.Enclosure{enclosure}, Extensions: media}, "https://example.com/inline.png"},
+		{"image enclosure", &gofeed.Item{Enclosures: []*gofeed.Enclosure{enclosure}, Extensions: media}, enclosure.URL},
+		{"media image", &gofeed.Item{Extensions: media}, "https://example.com/media.png"},
+		{"no image", &gofeed.Item{Content: "<p>Text</p>"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := itemImage(tt.item); got != tt.want {
+				t.Errorf("itemImage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
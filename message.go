@@ -0,0 +1,368 @@
+package rss2telegram
+
+import (
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	md "github.com/Skarlso/html-to-markdown"
+	"github.com/mmcdole/gofeed"
+)
+
+// defaultMessageTemplates are the templates of a message per parse mode used when MESSAGE_TEMPLATE is not set.
+// The byline and the reading time are empty unless they are included, so the default output is kept as is.
+var defaultMessageTemplates = map[string]string{
+	parseModeMarkdown:   "*{{.Title}}*{{with .Byline}}\n{{.}}{{end}}{{with .ReadingTime}}\n{{.}}{{end}}\n\n{{.Content}}",
+	parseModeMarkdownV2: "*{{.Title}}*{{with .Byline}}\n{{.}}{{end}}{{with .ReadingTime}}\n{{.}}{{end}}\n\n{{.Content}}",
+	parseModeHTML:       "<b>{{.Title}}</b>{{with .Byline}}\n{{.}}{{end}}{{with .ReadingTime}}\n{{.}}{{end}}\n\n{{.Content}}",
+	parseModeNone:       "{{.Title}}{{with .Byline}}\n{{.}}{{end}}{{with .ReadingTime}}\n{{.}}{{end}}\n\n{{.Content}}",
+}
+
+// readingWordsPerMinute is the reading speed the reading time of items is estimated with.
+const readingWordsPerMinute = 200
+
+// messageOptions holds the settings of rendering feed items as messages.
+type messageOptions struct {
+	// parseMode is the telegram parse mode of messages.
+	parseMode string
+	// template is the template used to render feed items as messages.
+	template *template.Template
+	// includeLink appends the item link to the message.
+	includeLink bool
+	// titleOnly leaves the content of the message empty.
+	titleOnly bool
+	// maxContentChars is the maximum length of the item content in characters, zero means unlimited.
+	maxContentChars int
+	// trackingParams are the query parameters stripped from links, nil to keep links as is.
+	trackingParams []string
+	// dateLayout is the layout the published time is formatted with, empty to keep it as in the feed.
+	dateLayout string
+	// location is the time zone the published time is formatted in.
+	location *time.Location
+	// includeHashtags appends the item categories as hashtags to the message.
+	includeHashtags bool
+	// hashtag is the hashtag of the feed appended to the message, empty for none.
+	hashtag string
+	// feedTitle is the title of the feed prepended to the message, empty for no prefix.
+	feedTitle string
+	// includeAuthor adds the "by {author}" line beneath the title to the message.
+	includeAuthor bool
+	// showReadingTime adds the estimated reading time of the item content to the message.
+	showReadingTime bool
+	// preserveCode keeps the code of the content as is in fenced code blocks and inline code.
+	preserveCode bool
+	// prefix is prepended to the message as is, empty for no prefix.
+	prefix string
+	// titlePrefix is stripped from item titles with the separator following it, empty to keep titles as is.
+	titlePrefix string
+}
+
+// message is the data of a feed item available to the message template.
+type message struct {
+	Title       string
+	Link        string
+	Author      string
+	Byline      string
+	Published   string
+	ReadingTime string
+	Content     string
+}
+
+// parseMessageTemplate parses text as a message template, using the default template
+// of parseMode if text is empty.
+func parseMessageTemplate(text, parseMode string) (*template.Template, error) {
+	if text == "" {
+		text = defaultMessageTemplates[parseMode]
+	}
+	return template.New("message").Parse(text)
+}
+
+// renderMessage renders item as a message text according to opts.
+func renderMessage(opts messageOptions, item *gofeed.Item) (string, error) {
+	var content string
+	if !opts.titleOnly {
+		content = renderContent(opts, item)
+	}
+
+	m := message{
+		Title:     escapeField(opts.parseMode, opts.title(item)),
+		Link:      escapeField(opts.parseMode, opts.link(item)),
+		Published: escapeField(opts.parseMode, opts.published(item)),
+		Content:   content,
+	}
+	if authors := itemAuthors(item); len(authors) > 0 {
+		m.Author = escapeField(opts.parseMode, strings.Join(authors, ", "))
+		if opts.includeAuthor {
+			m.Byline = escapeText(opts.parseMode, "by "+strings.Join(authors, ", "))
+		}
+	}
+
+	if opts.showReadingTime {
+		m.ReadingTime = escapeField(opts.parseMode, readingTime(item))
+	}
+
+	var b strings.Builder
+	if err := opts.template.Execute(&b, m); err != nil {
+		return "", err
+	}
+	// trim the separator after the title of items without content
+	text := strings.TrimRight(b.String(), " \n")
+
+	if link := opts.link(item); opts.includeLink && link != "" {
+		text += "\n\n" + escapeText(opts.parseMode, link)
+	}
+
+	if tags := opts.hashtags(item); len(tags) > 0 {
+		text += "\n\n" + escapeText(opts.parseMode, strings.Join(tags, " "))
+	}
+
+	return opts.withHeader(text), nil
+}
+
+// withHeader returns text prefixed with the line of opts.feedTitle and opts.prefix if they are set,
+// so messages of several feeds posted to the same chat are distinguishable.
+func (opts messageOptions) withHeader(text string) string {
+	if opts.feedTitle != "" {
+		text = escapeText(opts.parseMode, opts.feedTitle) + "\n" + text
+	}
+	if opts.prefix != "" {
+		text = escapeText(opts.parseMode, opts.prefix) + " " + text
+	}
+	return text
+}
+
+// renderContent converts the content of item to the text formatted according to opts.parseMode.
+// If opts.maxContentChars is set, longer content is truncated and followed by the item link.
+func renderContent(opts messageOptions, item *gofeed.Item) string {
+	var content string
+	switch opts.parseMode {
+	case parseModeHTML:
+		// html-to-markdown output is not valid in HTML parse mode, keep the tags telegram supports instead
+		content = sanitizeHTML(itemContent(item), opts.trackingParams)
+	case parseModeNone:
+		content = htmlToText(itemContent(item))
+		if opts.trackingParams != nil {
+			content = stripTrackingParamsInText(content, opts.trackingParams)
+		}
+	default:
+		var err error
+		content, err = convertHTML(opts.converter(), itemContent(item))
+		if err != nil {
+			// raw HTML is not valid markdown, fall back to the plain text of the content
+			logger.Warn("converting content to markdown", "error", err)
+			content = htmlToText(itemContent(item))
+		}
+		if opts.trackingParams != nil {
+			content = stripTrackingParamsInText(content, opts.trackingParams)
+		}
+		content = normalizeMarkdown(content)
+		switch {
+		case err != nil:
+			content = escapeText(opts.parseMode, content)
+		case opts.parseMode == parseModeMarkdownV2:
+			content = markdownToV2(content)
+		}
+	}
+
+	if opts.maxContentChars > 0 && utf8.RuneCountInString(content) > opts.maxContentChars {
+		content = truncateMessage(content, opts.maxContentChars, opts.parseMode) + "…"
+		if link := opts.link(item); !opts.includeLink && link != "" {
+			// the link is appended to the message anyway if includeLink is set
+			content += "\n\n" + escapeText(opts.parseMode, link)
+		}
+	}
+
+	return content
+}
+
+// readingTime returns the estimated reading time of the content of item, e.g. "3 min read",
+// counted on the words of its plain text. Returns empty string for items without content.
+func readingTime(item *gofeed.Item) string {
+	words := len(strings.Fields(htmlToText(itemContent(item))))
+	if words == 0 {
+		return ""
+	}
+	minutes := (words + readingWordsPerMinute - 1) / readingWordsPerMinute
+	return strconv.Itoa(minutes) + " min read"
+}
+
+// converter returns the converter of the HTML content of items to markdown of opts.parseMode.
+func (opts messageOptions) converter() *md.Converter {
+	return newConverter(opts.parseMode, opts.preserveCode)
+}
+
+// newConverter returns the converter of the HTML content of items to markdown of parseMode,
+// keeping the code as is if preserveCode is set. Telegram markdown delimits bold by single asterisks,
+// while the markdown converted to MarkdownV2 by markdownToV2 delimits it by double ones,
+// as markdownToV2 reads single asterisks as italic.
+func newConverter(parseMode string, preserveCode bool) *md.Converter {
+	delimiter := "*"
+	if parseMode == parseModeMarkdownV2 {
+		delimiter = "**"
+	}
+	c := md.NewConverter("", true, nil).AddRules(textRule, strongRule(delimiter), brRule)
+	if preserveCode {
+		c.AddRules(codeRules...)
+	}
+	return c
+}
+
+// convertHTML converts HTML to markdown with the converter, tests replace it to fail the conversion.
+var convertHTML = (*md.Converter).ConvertString
+
+// titleSeparators are the characters separating the site name prefix from item titles.
+const titleSeparators = " \t-–—|:·»"
+
+// title returns the title of item without opts.titlePrefix and the separator following it.
+// Titles consisting of the prefix only are kept as is.
+func (opts messageOptions) title(item *gofeed.Item) string {
+	if opts.titlePrefix == "" || !strings.HasPrefix(item.Title, opts.titlePrefix) {
+		return item.Title
+	}
+	if title := strings.TrimLeft(strings.TrimPrefix(item.Title, opts.titlePrefix), titleSeparators); title != "" {
+		return title
+	}
+	return item.Title
+}
+
+// commonTitlePrefix returns the title of feed if the titles of all its items start with it,
+// e.g. "MySite" of items "MySite - Article". Returns empty string otherwise.
+func commonTitlePrefix(feed *gofeed.Feed) string {
+	prefix := strings.TrimSpace(feed.Title)
+	if prefix == "" || len(feed.Items) == 0 {
+		return ""
+	}
+	for _, item := range feed.Items {
+		if !strings.HasPrefix(item.Title, prefix) {
+			return ""
+		}
+	}
+	return prefix
+}
+
+// link returns the link of item stripped of tracking parameters.
+func (opts messageOptions) link(item *gofeed.Item) string {
+	if opts.trackingParams == nil {
+		return item.Link
+	}
+	return stripTrackingParams(item.Link, opts.trackingParams)
+}
+
+// published returns the published time of item formatted with opts.dateLayout in opts.location,
+// or as it is in the feed if the layout is not set or the time can't be parsed.
+func (opts messageOptions) published(item *gofeed.Item) string {
+	if t := itemPublishedAt(item); opts.dateLayout != "" && t != nil {
+		loc := opts.location
+		if loc == nil {
+			loc = time.UTC
+		}
+		return t.In(loc).Format(opts.dateLayout)
+	}
+
+	if item.Published != "" {
+		return item.Published
+	}
+	return item.Updated
+}
+
+// itemContent returns the content of item, falling back to its description
+// for feeds that only populate the latter (e.g. Atom summaries).
+func itemContent(item *gofeed.Item) string {
+	if item.Content != "" {
+		return item.Content
+	}
+	return item.Description
+}
+
+// itemAuthors returns the unique names of the authors of item, the author followed by
+// the other authors of Atom entries (see authorsTranslator) and the Dublin Core creators
+// for feeds listing several of them.
+func itemAuthors(item *gofeed.Item) []string {
+	var names []string
+	if item.Author != nil {
+		names = append(names, item.Author.Name)
+	}
+	if authors := item.Custom["authors"]; authors != "" {
+		names = append(names, strings.Split(authors, "\n")...)
+	}
+	if item.DublinCoreExt != nil {
+		names = append(names, item.DublinCoreExt.Creator...)
+	}
+
+	var authors []string
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		name = strings.Join(strings.Fields(name), " ")
+		if name == "" || seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		authors = append(authors, name)
+	}
+	return authors
+}
+
+// hashtags returns opts.hashtag of the feed followed by the hashtags of the item categories
+// if opts.includeHashtags is set.
+func (opts messageOptions) hashtags(item *gofeed.Item) []string {
+	var tags []string
+	if opts.hashtag != "" {
+		tags = append(tags, opts.hashtag)
+	}
+	if opts.includeHashtags {
+		for _, tag := range hashtags(item.Categories) {
+			if !strings.EqualFold(tag, opts.hashtag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// feedHashtag returns s as a hashtag of letters, digits and underscores with a leading "#",
+// other characters are stripped. Returns empty string if s has none of them.
+func feedHashtag(s string) string {
+	tag := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			return r
+		}
+		return -1
+	}, s)
+	if tag == "" {
+		return ""
+	}
+	return "#" + tag
+}
+
+// hashtags returns categories as unique hashtags, each category stripped of
+// all characters but letters and digits. Empty categories are skipped.
+func hashtags(categories []string) []string {
+	var tags []string
+	seen := make(map[string]bool, len(categories))
+	for _, c := range categories {
+		tag := strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return r
+			}
+			return -1
+		}, c)
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		tags = append(tags, "#"+tag)
+	}
+	return tags
+}
+
+// escapeField escapes the value of a message template field for parseMode.
+// Markdown does not support escaping inside of entities, so fields are left as is.
+func escapeField(parseMode, s string) string {
+	if parseMode == parseModeMarkdown {
+		return s
+	}
+	return escapeText(parseMode, s)
+}
@@ -0,0 +1,367 @@
+package rss2telegram
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	md "github.com/Skarlso/html-to-markdown"
+	"github.com/mmcdole/gofeed"
+)
+
+// testMessageOptions returns messageOptions rendering messages in parseMode with the default template.
+func testMessageOptions(t *testing.T, parseMode string) messageOptions {
+	tmpl, err := parseMessageTemplate("", parseMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return messageOptions{parseMode: parseMode, template: tmpl}
+}
+
+func TestRenderMessageLink(t *testing.T) {
+	tests := []struct {
+		name        string
+		parseMode   string
+		includeLink bool
+		want        string
+	}{
+		{"markdown", parseModeMarkdown, true, "\n\nhttps://example.com/some\\_article?a=1&b=2"},
+		{"MarkdownV2", parseModeMarkdownV2, true, "\n\nhttps://example\\.com/some\\_article?a\\=1&b\\=2"},
+		{"HTML", parseModeHTML, true, "\n\nhttps://example.com/some_article?a=1&amp;b=2"},
+		{"without link", parseModeMarkdown, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := testMessageOptions(t, tt.parseMode)
+			opts.includeLink = tt.includeLink
+			item := &gofeed.Item{Title: "Title", Link: "https://example.com/some_article?a=1&b=2", Content: "<p>Body</p>"}
+
+			text, err := renderMessage(opts, item)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == "" {
+				if strings.Contains(text, "example.com") {
+					t.Errorf("text = %q, want no link", text)
+				}
+				return
+			}
+			if !strings.HasSuffix(text, tt.want) {
+				t.Errorf("text = %q, want the link %q at the end", text, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderMessageDescriptionOnly(t *testing.T) {
+	tests := []struct {
+		name string
+		item *gofeed.Item
+		want string
+	}{
+		{"description", &gofeed.Item{Title: "Title", Description: "<p>Summary of <b>the</b> article</p>"}, "*Title*\n\nSummary of *the* article"},
+		{"content", &gofeed.Item{Title: "Title", Description: "<p>Summary</p>", Content: "<p>Content</p>"}, "*Title*\n\nContent"},
+		{"title only", &gofeed.Item{Title: "Title"}, "*Title*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, err := renderMessage(testMessageOptions(t, parseModeMarkdown), tt.item)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if text != tt.want {
+				t.Errorf("renderMessage() = %q, want %q", text, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderMessageRSSDescription(t *testing.T) {
+	feed, err := gofeed.NewParser().Parse(strings.NewReader(`<?xml version="1.0"?><rss version="2.0"><channel><title>Feed</title>` +
+		`<item><title>One</title><link>https://example.com/1</link><description>Body of One</description></item></channel></rss>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := testMessageOptions(t, parseModeMarkdown)
+	opts.includeLink = true
+
+	text, err := renderMessage(opts, feed.Items[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "*One*\n\nBody of One\n\nhttps://example.com/1"; text != want {
+		t.Errorf("renderMessage() = %q, want %q", text, want)
+	}
+}
+
+func TestRenderMessageAuthors(t *testing.T) {
+	tests := []struct {
+		name string
+		feed string
+		want string
+	}{
+		{"rss creators", `<?xml version="1.0"?><rss version="2.0" xmlns:dc="http://purl.org/dc/elements/1.1/"><channel><title>Feed</title>
+<item><title>Title</title><dc:creator>Alice</dc:creator><dc:creator>Bob Smith</dc:creator><dc:creator>alice</dc:creator></item>
+</channel></rss>`, "*Title*\nby Alice, Bob Smith"},
+		{"rss author", `<?xml version="1.0"?><rss version="2.0"><channel><title>Feed</title>
+<item><title>Title</title><author>carol@example.com (Carol)</author></item>
+</channel></rss>`, "*Title*\nby Carol"},
+		{"atom authors", `<?xml version="1.0" encoding="utf-8"?><feed xmlns="http://www.w3.org/2005/Atom"><title>Feed</title>
+<entry><title>Title</title><id>urn:1</id><author><name>Alice</name></author><author><name>Bob</name></author></entry>
+</feed>`, "*Title*\nby Alice, Bob"},
+		{"no author", `<?xml version="1.0"?><rss version="2.0"><channel><title>Feed</title>
+<item><title>Title</title></item>
+</channel></rss>`, "*Title*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feed, err := parseFeed(strings.NewReader(tt.feed))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tmpl, err := parseMessageTemplate("", parseModeMarkdown)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := messageOptions{parseMode: parseModeMarkdown, template: tmpl, includeAuthor: true}
+			got, err := renderMessage(opts, feed.Items[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("renderMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTitlePrefix(t *testing.T) {
+	tests := []struct {
+		prefix, title, want string
+	}{
+		{"MySite", "MySite - Article", "Article"},
+		{"MySite", "MySite | Article", "Article"},
+		{"MySite", "MySite: Article", "Article"},
+		{"MySite", "MySite — Article", "Article"},
+		{"MySite", "MySite", "MySite"},
+		{"MySite", "Other - Article", "Other - Article"},
+		{"", "MySite - Article", "MySite - Article"},
+	}
+	for _, tt := range tests {
+		opts := messageOptions{titlePrefix: tt.prefix}
+		if got := opts.title(&gofeed.Item{Title: tt.title}); got != tt.want {
+			t.Errorf("title(%q) with prefix %q = %q, want %q", tt.title, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestCommonTitlePrefix(t *testing.T) {
+	items := func(titles ...string) []*gofeed.Item {
+		var items []*gofeed.Item
+		for _, title := range titles {
+			items = append(items, &gofeed.Item{Title: title})
+		}
+		return items
+	}
+	tests := []struct {
+		name string
+		feed *gofeed.Feed
+		want string
+	}{
+		{"all items", &gofeed.Feed{Title: " MySite ", Items: items("MySite - A", "MySite: B")}, "MySite"},
+		{"some items", &gofeed.Feed{Title: "MySite", Items: items("MySite - A", "B")}, ""},
+		{"no items", &gofeed.Feed{Title: "MySite"}, ""},
+		{"no title", &gofeed.Feed{Items: items("A")}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := commonTitlePrefix(tt.feed); got != tt.want {
+				t.Errorf("commonTitlePrefix() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripTitlePrefixConfig(t *testing.T) {
+	tests := []struct {
+		name, prefix string
+		wantPrefix   string
+		wantAuto     bool
+	}{
+		{"auto", titlePrefixAuto, "", true},
+		{"explicit", "Feed -", "Feed -", false},
+		{"none", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{FeedURLs: []string{"https://example.com/feed"}, BotAPIToken: "token", ChatIDs: []string{"1"}}
+			cfg.StripTitlePrefix = tt.prefix
+
+			bot, opts, err := cfg.settings()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bot.message.titlePrefix != tt.wantPrefix || opts.autoTitlePrefix != tt.wantAuto {
+				t.Errorf("titlePrefix, autoTitlePrefix = %q, %v, want %q, %v", bot.message.titlePrefix, opts.autoTitlePrefix, tt.wantPrefix, tt.wantAuto)
+			}
+		})
+	}
+}
+
+func TestRenderContentBlockquote(t *testing.T) {
+	item := &gofeed.Item{Content: "<p>He wrote:</p><blockquote><p>Quote</p><blockquote>Nested <b>bold</b></blockquote><p>after.</p></blockquote><p>Text</p>"}
+	tests := []struct {
+		parseMode string
+		want      string
+	}{
+		{parseModeMarkdownV2, "He wrote:\n\n>Quote\n>\n>Nested *bold*\n>\n>after\\.\n\nText"},
+		{parseModeHTML, "He wrote:\n\n<blockquote>Quote\n\nNested <b>bold</b>\n\nafter.</blockquote>\n\nText"},
+		{parseModeMarkdown, "He wrote:\n\n> Quote\n>\n> > Nested *bold*\n>\n> after.\n\nText"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.parseMode, func(t *testing.T) {
+			if got := renderContent(messageOptions{parseMode: tt.parseMode}, item); got != tt.want {
+				t.Errorf("renderContent() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderContentConverterError(t *testing.T) {
+	defer func(f func(*md.Converter, string) (string, error)) { convertHTML = f }(convertHTML)
+	convertHTML = func(*md.Converter, string) (string, error) {
+		return "", errors.New("conversion failed")
+	}
+
+	item := &gofeed.Item{Content: `<p>Some <b>bold_text</b> and <a href="https://example.com">a [link]</a>.</p><p>2 * 3 = 6</p>`}
+	tests := []struct {
+		parseMode string
+		want      string
+	}{
+		{parseModeMarkdown, "Some bold\\_text and a \\[link].\n\n2 \\* 3 = 6"},
+		{parseModeMarkdownV2, "Some bold\\_text and a \\[link\\]\\.\n\n2 \\* 3 \\= 6"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.parseMode, func(t *testing.T) {
+			got := renderContent(messageOptions{parseMode: tt.parseMode}, item)
+			if got != tt.want {
+				t.Errorf("renderContent() = %q, want the escaped plain text %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderMessageConverterError(t *testing.T) {
+	defer func(f func(*md.Converter, string) (string, error)) { convertHTML = f }(convertHTML)
+	convertHTML = func(*md.Converter, string) (string, error) {
+		return "", errors.New("conversion failed")
+	}
+
+	item := &gofeed.Item{Title: "Title", Content: "<div><p>Body with <i>tags</i></p></div>"}
+	got, err := renderMessage(testMessageOptions(t, parseModeMarkdown), item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "*Title*\n\nBody with tags"; got != want {
+		t.Errorf("renderMessage() = %q, want %q", got, want)
+	}
+}
+
+func TestRenderMessageBold(t *testing.T) {
+	item := &gofeed.Item{
+		Title:   "Title 1+1",
+		Content: `<p><b>bold</b> <strong>strong</strong>, x<b> padded </b>y, <b>2*2=4_</b> and <b>[1]</b></p>`,
+	}
+	tests := []struct {
+		parseMode string
+		want      string
+	}{
+		{parseModeMarkdown, "*Title 1+1*\n\n*bold* *strong*, x *padded* y, *2*\\**2=4*\\_ and \\[*1]*"},
+		{parseModeMarkdownV2, "*Title 1\\+1*\n\n*bold* *strong*, x *padded* y, *2\\*2\\=4\\_* and *\\[1\\]*"},
+		{parseModeHTML, "<b>Title 1+1</b>\n\n<b>bold</b> <strong>strong</strong>, x<b> padded </b>y, <b>2*2=4_</b> and <b>[1]</b>"},
+		{parseModeNone, "Title 1+1\n\nbold strong, x padded y, 2*2=4_ and [1]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.parseMode, func(t *testing.T) {
+			tmpl, err := parseMessageTemplate("", tt.parseMode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := renderMessage(messageOptions{parseMode: tt.parseMode, template: tmpl}, item)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("renderMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderContentWhitespace(t *testing.T) {
+	item := &gofeed.Item{
+		Content: "\n\n  <div>\n\n<p>First   paragraph   \n with\ttabs\t\t and  <b>bold</b>  <i>words</i>.   </p>\n\n\n\n<p>   </p><br><br><br>" +
+			"<p>Second<br>\n line</p>\n\n<div><div><p>  Nested</p></div></div>  \n\n <ul>\n <li>one </li>\n\n <li> two</li>\n</ul>\n" +
+			"<pre>code   \n\n\n\n  kept  </pre>\n</div>  \n",
+	}
+	tests := []struct {
+		parseMode string
+		want      string
+	}{
+		{parseModeMarkdown, "First paragraph with tabs and *bold* words.\n\nSecond\nline\n\nNested\n\n- one\n- two\n\n```\ncode   \n\n  kept  \n```"},
+		{parseModeMarkdownV2, "First paragraph with tabs and *bold* words\\.\n\nSecond\nline\n\nNested\n\n\\- one\n\\- two\n\n```\ncode   \n\n  kept  \n```"},
+		{parseModeHTML, "First paragraph with tabs and <b>bold</b> <i>words</i>.\n\nSecond\nline\n\nNested\n\none\ntwo\n\n<pre>code   \n\n\n\n  kept  </pre>"},
+		{parseModeNone, "First paragraph with tabs and bold words.\n\nSecond\nline\n\nNested\n\none\ntwo\n\ncode kept"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.parseMode, func(t *testing.T) {
+			got := renderContent(messageOptions{parseMode: tt.parseMode}, item)
+			if got != tt.want {
+				t.Errorf("renderContent() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadingTime(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"empty", "", ""},
+		{"tags only", "<p><img src=\"a.png\"></p>", ""},
+		{"short", "<p>Hello <b>world</b></p>", "1 min read"},
+		{"exact minutes", strings.Repeat("word ", 400), "2 min read"},
+		{"rounded up", "<p>" + strings.Repeat("word ", 401) + "</p>", "3 min read"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := readingTime(&gofeed.Item{Content: tt.content}); got != tt.want {
+				t.Errorf("readingTime() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderMessageReadingTime(t *testing.T) {
+	tmpl, err := parseMessageTemplate("", parseModeHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := messageOptions{parseMode: parseModeHTML, template: tmpl, showReadingTime: true}
+	item := &gofeed.Item{Title: "Title", Content: "<p>" + strings.Repeat("word ", 250) + "</p>"}
+
+	got, err := renderMessage(opts, item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<b>Title</b>\n2 min read\n\n"; !strings.HasPrefix(got, want) {
+		t.Errorf("renderMessage() = %q, want prefix %q", got, want)
+	}
+
+	opts.showReadingTime = false
+	if got, _ := renderMessage(opts, item); strings.Contains(got, "min read") {
+		t.Errorf("renderMessage() without reading time = %q", got)
+	}
+}
@@ -0,0 +1,37 @@
+package rss2telegram
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	itemsFetched = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "rss2telegram_items_fetched_total",
+		Help: "Number of items in the retrieved feeds.",
+	})
+	itemsSent = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "rss2telegram_items_sent_total",
+		Help: "Number of items sent to telegram.",
+	})
+	itemsFailed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "rss2telegram_items_failed_total",
+		Help: "Number of items failed to send to telegram.",
+	})
+	itemsFiltered = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "rss2telegram_items_filtered_total",
+		Help: "Number of new items not passed the filters.",
+	})
+	telegramRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "rss2telegram_telegram_request_duration_seconds",
+		Help: "Latency of telegram bot api requests.",
+	}, []string{"method"})
+)
+
+// recordMetrics adds the counts of the run summary s to the metrics.
+func recordMetrics(s Summary) {
+	itemsFetched.Add(float64(s.ItemsFetched))
+	itemsSent.Add(float64(s.ItemsSent))
+	itemsFailed.Add(float64(s.ItemsFailed))
+	itemsFiltered.Add(float64(s.ItemsFiltered))
+}
@@ -0,0 +1,79 @@
+package rss2telegram
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// opmlDocument is an OPML document of subscriptions exported from a feed reader.
+type opmlDocument struct {
+	XMLName  xml.Name      `xml:"opml"`
+	Outlines []opmlOutline `xml:"body>outline"`
+}
+
+// opmlOutline is an outline of OPML document, a feed if it has xmlUrl or a folder of nested outlines.
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	XMLURL   string        `xml:"xmlUrl,attr"`
+	ChatID   string        `xml:"chatId,attr"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// readOPMLFile returns the feeds of OPML file at path, the feeds of nested outlines included, e.g.
+//
+//	<opml version="2.0">
+//	  <body>
+//	    <outline text="Go" xmlUrl="https://go.dev/blog/feed.atom" chatId="@golangnews"/>
+//	    <outline text="Blogs">
+//	      <outline text="Example" xmlUrl="https://example.com/feed.xml"/>
+//	    </outline>
+//	  </body>
+//	</opml>
+//
+// The comma-separated chatId attribute of an outline sets the chats of the feed, feeds without it
+// are posted to TELEGRAM_CHAT_ID.
+func readOPMLFile(path string) ([]FeedConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("opml file: %v", err)
+	}
+
+	feeds, err := parseOPML(data)
+	if err != nil {
+		return nil, fmt.Errorf("opml file %s: %v", path, err)
+	}
+	return feeds, nil
+}
+
+// parseOPML returns the feeds of OPML document data.
+func parseOPML(data []byte) ([]FeedConfig, error) {
+	var doc opmlDocument
+	d := xml.NewDecoder(bytes.NewReader(data))
+	// exports of feed readers declare various encodings, the names of feeds are not used anyway
+	d.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) { return input, nil }
+	if err := d.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	feeds := opmlFeeds(doc.Outlines)
+	if len(feeds) == 0 {
+		return nil, errors.New("no outlines with xmlUrl")
+	}
+	return feeds, nil
+}
+
+// opmlFeeds returns the feeds of outlines and of their nested outlines.
+func opmlFeeds(outlines []opmlOutline) []FeedConfig {
+	var feeds []FeedConfig
+	for _, o := range outlines {
+		if o.XMLURL != "" {
+			feeds = append(feeds, FeedConfig{URL: o.XMLURL, ChatIDs: splitList(o.ChatID)})
+		}
+		feeds = append(feeds, opmlFeeds(o.Outlines)...)
+	}
+	return feeds
+}
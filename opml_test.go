@@ -0,0 +1,48 @@
+package rss2telegram
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseOPML(t *testing.T) {
+	data := `<?xml version="1.0" encoding="ISO-8859-1"?>
+<opml version="2.0">
+  <body>
+    <outline text="Go" xmlUrl="https://go.dev/blog/feed.atom" chatId="@golangnews, -1001234567890"/>
+    <outline text="Blogs">
+      <outline text="Example" xmlUrl="https://example.com/feed.xml"/>
+      <outline text="No feed" htmlUrl="https://example.org/"/>
+    </outline>
+  </body>
+</opml>`
+
+	feeds, err := parseOPML([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// outlines without xmlUrl are folders or links, not feeds
+	if len(feeds) != 2 || feeds[0].URL != "https://go.dev/blog/feed.atom" || strings.Join(feeds[0].ChatIDs, ",") != "@golangnews,-1001234567890" ||
+		feeds[1].URL != "https://example.com/feed.xml" || len(feeds[1].ChatIDs) != 0 {
+		t.Errorf("parseOPML() = %+v", feeds)
+	}
+}
+
+func TestParseOPMLInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"malformed", `<opml version="2.0"><body><outline text="Go" xmlUrl="https://go.dev/blog/feed.atom"></body></opml>`, "XML syntax error"},
+		{"not opml", `<rss version="2.0"><channel><title>Feed</title></channel></rss>`, "expected element type <opml>"},
+		{"outline without xmlUrl", `<opml version="2.0"><body><outline text="Blogs"><outline text="No feed"/></outline></body></opml>`, "no outlines with xmlUrl"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseOPML([]byte(tt.data)); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseOPML() error = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package rss2telegram
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Telegram parse modes of messages.
+const (
+	parseModeMarkdown   = "markdown"
+	parseModeMarkdownV2 = "MarkdownV2"
+	parseModeHTML       = "HTML"
+	// parseModeNone sends messages as plain text without parse_mode.
+	parseModeNone = "none"
+)
+
+// parseParseMode returns the telegram parse mode named s, defaulting to markdown if s is empty.
+func parseParseMode(s string) (string, error) {
+	if s == "" {
+		return parseModeMarkdown, nil
+	}
+	for _, mode := range []string{parseModeMarkdown, parseModeMarkdownV2, parseModeHTML, parseModeNone} {
+		if strings.EqualFold(s, mode) {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("unknown parse mode %q", s)
+}
+
+// escapeText escapes s so that it is rendered as is in telegram parseMode.
+func escapeText(parseMode, s string) string {
+	switch parseMode {
+	case parseModeHTML:
+		return html.EscapeString(s)
+	case parseModeMarkdownV2:
+		return escapeMarkdownV2(s)
+	case parseModeNone:
+		// plain text is rendered as is
+		return s
+	default:
+		return escapeMarkdown(s)
+	}
+}
+
+// markdownEscaper escapes characters that start an entity in telegram markdown.
+var markdownEscaper = strings.NewReplacer("_", "\\_", "*", "\\*", "`", "\\`", "[", "\\[")
+
+// escapeMarkdown escapes s so that it is rendered as is in telegram markdown,
+// e.g. underscores in urls are not treated as italic.
+func escapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+// markdownV2Escaper escapes characters reserved in telegram MarkdownV2.
+var markdownV2Escaper = strings.NewReplacer(
+	"\\", "\\\\", "_", "\\_", "*", "\\*", "[", "\\[", "]", "\\]", "(", "\\(", ")", "\\)",
+	"~", "\\~", "`", "\\`", ">", "\\>", "#", "\\#", "+", "\\+", "-", "\\-", "=", "\\=",
+	"|", "\\|", "{", "\\{", "}", "\\}", ".", "\\.", "!", "\\!",
+)
+
+// escapeMarkdownV2 escapes s so that it is rendered as is in telegram MarkdownV2.
+func escapeMarkdownV2(s string) string {
+	return markdownV2Escaper.Replace(s)
+}
+
+// markdownV2CodeEscaper escapes characters reserved inside of telegram MarkdownV2 code entities.
+var markdownV2CodeEscaper = strings.NewReplacer("\\", "\\\\", "`", "\\`")
+
+// markdownV2URLEscaper escapes characters reserved inside of telegram MarkdownV2 link urls.
+var markdownV2URLEscaper = strings.NewReplacer("\\", "\\\\", ")", "\\)")
+
+// markdownToV2 converts markdown s produced by html-to-markdown converter to telegram MarkdownV2.
+// Bold, italic, code, link and blockquote entities are kept, all other reserved characters are escaped.
+func markdownToV2(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		rest := s[i:]
+
+		if rest[0] == '>' && (i == 0 || s[i-1] == '\n') {
+			// blockquote line, telegram does not support nested blockquotes so they are flattened
+			n := len(rest) - len(strings.TrimLeft(rest, "> "))
+			if nl := strings.IndexByte(rest, '\n'); nl >= 0 && nl < n {
+				n = nl
+			}
+			b.WriteString(">")
+			i += n
+			continue
+		}
+
+		if rest[0] == '\\' && len(rest) > 1 && strings.ContainsRune(markdownPunctuation, rune(rest[1])) {
+			// markdown escaped character
+			b.WriteString(escapeMarkdownV2(rest[1:2]))
+			i += 2
+			continue
+		}
+
+		if n, ok := convertMarkdownEntity(&b, rest); ok {
+			i += n
+			continue
+		}
+
+		_, size := utf8.DecodeRuneInString(rest)
+		b.WriteString(escapeMarkdownV2(rest[:size]))
+		i += size
+	}
+	return b.String()
+}
+
+// markdownPunctuation are the characters that can be backslash-escaped in markdown.
+const markdownPunctuation = "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
+
+// convertMarkdownEntity writes the MarkdownV2 form of the markdown entity s starts with to b.
+// Returns the length of the entity in s, or false if s does not start with a complete entity.
+func convertMarkdownEntity(b *strings.Builder, s string) (int, bool) {
+	for _, e := range []struct{ open, close, v2 string }{
+		{"```", "```", "```"},
+		{"`", "`", "`"},
+		{"**", "**", "*"},
+		{"__", "__", "*"},
+		{"*", "*", "_"},
+		{"_", "_", "_"},
+	} {
+		if !strings.HasPrefix(s, e.open) {
+			continue
+		}
+		end := strings.Index(s[len(e.open):], e.close)
+		if end <= 0 {
+			return 0, false
+		}
+		inner := s[len(e.open) : len(e.open)+end]
+
+		b.WriteString(e.v2)
+		if e.v2 == "```" || e.v2 == "`" {
+			b.WriteString(markdownV2CodeEscaper.Replace(inner))
+		} else {
+			b.WriteString(markdownToV2(inner))
+		}
+		b.WriteString(e.v2)
+		return len(e.open) + end + len(e.close), true
+	}
+
+	if strings.HasPrefix(s, "[") {
+		textEnd := strings.Index(s, "](")
+		if textEnd <= 1 {
+			return 0, false
+		}
+		urlEnd := strings.IndexByte(s[textEnd+2:], ')')
+		if urlEnd <= 0 {
+			return 0, false
+		}
+		b.WriteString("[")
+		b.WriteString(markdownToV2(s[1:textEnd]))
+		b.WriteString("](")
+		b.WriteString(markdownV2URLEscaper.Replace(s[textEnd+2 : textEnd+2+urlEnd]))
+		b.WriteString(")")
+		return textEnd + 2 + urlEnd + 1, true
+	}
+
+	return 0, false
+}
+
+var (
+	// spaces matches runs of whitespace collapsed to a single space in HTML text.
+	spaces = regexp.MustCompile(`[ \t\r\n]+`)
+	// lineSpaces matches a line break with surrounding spaces.
+	lineSpaces = regexp.MustCompile(` *\n *`)
+	// blankLines matches runs of more than one blank line.
+	blankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+// normalizeMarkdown trims the trailing whitespace of lines of markdown s produced by html-to-markdown
+// converter and collapses runs of blank lines into a single one, so paragraphs stay separated.
+// The lines of fenced code blocks are kept as is.
+func normalizeMarkdown(s string) string {
+	lines := strings.Split(s, "\n")
+	out := lines[:0]
+	var code, blank bool
+	for _, line := range lines {
+		fence := strings.HasPrefix(strings.TrimSpace(line), "```")
+		if code && !fence {
+			out = append(out, line)
+			continue
+		}
+		if fence {
+			code = !code
+		}
+
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+		if line == "" && blank {
+			continue
+		}
+		blank = line == ""
+		out = append(out, line)
+	}
+	return strings.Trim(strings.Join(out, "\n"), "\n")
+}
+
+// htmlToText strips tags from HTML s leaving the plain text content,
+// block elements are separated by line breaks.
+func htmlToText(s string) string {
+	var b strings.Builder
+	var skip int
+	z := xhtml.NewTokenizer(strings.NewReader(s))
+	for {
+		switch tt := z.Next(); tt {
+		case xhtml.ErrorToken:
+			text := lineSpaces.ReplaceAllString(b.String(), "\n")
+			return strings.TrimSpace(blankLines.ReplaceAllString(text, "\n\n"))
+		case xhtml.TextToken:
+			if skip == 0 {
+				b.WriteString(spaces.ReplaceAllString(string(z.Text()), " "))
+			}
+		case xhtml.StartTagToken, xhtml.EndTagToken, xhtml.SelfClosingTagToken:
+			name, _ := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Script, atom.Style:
+				// skip the content of non-text elements
+				if tt == xhtml.StartTagToken {
+					skip++
+				} else if skip > 0 {
+					skip--
+				}
+			case atom.Br, atom.Li, atom.Tr:
+				if tt != xhtml.EndTagToken {
+					b.WriteString("\n")
+				}
+			case atom.P, atom.Div, atom.Blockquote, atom.Pre, atom.Ul, atom.Ol, atom.Table,
+				atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Hr:
+				b.WriteString("\n\n")
+			}
+		}
+	}
+}
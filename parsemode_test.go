@@ -0,0 +1,106 @@
+package rss2telegram
+
+import (
+	"context"
+	"html"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// markdownV2Reserved are the characters reserved in telegram MarkdownV2.
+const markdownV2Reserved = "_*[]()~`>#+-=|{}.!\\"
+
+func TestMarkdownV2Reserved(t *testing.T) {
+	opts := testMessageOptions(t, parseModeMarkdownV2)
+
+	for _, c := range markdownV2Reserved {
+		t.Run(string(c), func(t *testing.T) {
+			s := "a " + string(c) + " b"
+			item := &gofeed.Item{Title: s, Content: "<p>" + html.EscapeString(s) + "</p>"}
+			got, err := renderMessage(opts, item)
+			if err != nil {
+				t.Fatal(err)
+			}
+			escaped := "a \\" + string(c) + " b"
+			if want := "*" + escaped + "*\n\n" + escaped; got != want {
+				t.Errorf("renderMessage() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestEscapeMarkdownV2(t *testing.T) {
+	got := escapeMarkdownV2("v1.2 (beta) - 50% off! #1 a_b [x]")
+	if want := "v1\\.2 \\(beta\\) \\- 50% off\\! \\#1 a\\_b \\[x\\]"; got != want {
+		t.Errorf("escapeMarkdownV2() = %q, want %q", got, want)
+	}
+}
+
+func TestMarkdownToV2(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"bold", "**bold.** text", "*bold\\.* text"},
+		{"italic", "*it* and _it_", "_it_ and _it_"},
+		{"code", "`a*b.c`", "`a*b.c`"},
+		{"code block", "```\nif a > b {\n}\n```", "```\nif a > b {\n}\n```"},
+		{"link", "[a.b](https://x.io/a_b)", "[a\\.b](https://x.io/a_b)"},
+		{"markdown escapes", "1\\. item \\*", "1\\. item \\*"},
+		{"unclosed", "**open", "\\*\\*open"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := markdownToV2(tt.in); got != tt.want {
+				t.Errorf("markdownToV2(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseModeNone(t *testing.T) {
+	tg := newTelegramServer(t)
+	feed := newFeedServer(t, "application/rss+xml", `<?xml version="1.0"?><rss version="2.0"><channel><title>Feed</title>
+<item><title>Title with *stars* and _underscores_</title><link>https://example.com/a_b</link>
+<pubDate>`+rfc1123(time.Now().Add(-time.Hour))+`</pubDate>
+<description><![CDATA[<p>Some <b>bold</b> and <a href="https://example.com">a link</a> [1].</p><p>Second paragraph.</p>]]></description></item>
+</channel></rss>`)
+	cfg := testConfig(t, tg.URL, "1", feed.URL)
+	cfg.ParseMode = "none"
+
+	if _, err := RunWithConfig(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	sent := tg.sent()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(sent))
+	}
+	if mode, ok := sent[0].Params["parse_mode"]; ok {
+		t.Errorf("parse_mode = %q is sent, want none", mode)
+	}
+	want := "Title with *stars* and _underscores_\n\nSome bold and a link [1].\n\nSecond paragraph.\n\nhttps://example.com/a_b"
+	if got := sent[0].Params["text"]; got != want {
+		t.Errorf("text = %q, want %q", got, want)
+	}
+}
+
+func TestParseParseMode(t *testing.T) {
+	for s, want := range map[string]string{
+		"":           parseModeMarkdown,
+		"Markdown":   parseModeMarkdown,
+		"markdownv2": parseModeMarkdownV2,
+		"html":       parseModeHTML,
+		"None":       parseModeNone,
+	} {
+		if got, err := parseParseMode(s); err != nil || got != want {
+			t.Errorf("parseParseMode(%q) = %q, %v, want %q", s, got, err, want)
+		}
+	}
+	if _, err := parseParseMode("bbcode"); err == nil || !strings.Contains(err.Error(), "bbcode") {
+		t.Errorf("parseParseMode(bbcode) error = %v, want unknown parse mode", err)
+	}
+}
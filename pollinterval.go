@@ -0,0 +1,68 @@
+package rss2telegram
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+	"github.com/mmcdole/gofeed/rss"
+)
+
+// syndicationPeriods are the periods of sy:updatePeriod of the RSS syndication module.
+var syndicationPeriods = map[string]time.Duration{
+	"hourly":  time.Hour,
+	"daily":   24 * time.Hour,
+	"weekly":  7 * 24 * time.Hour,
+	"monthly": 30 * 24 * time.Hour,
+	"yearly":  365 * 24 * time.Hour,
+}
+
+// ttlTranslator translates RSS feeds like gofeed.DefaultRSSTranslator, keeping the <ttl> of the channel
+// in "ttl" custom field, which the default translator drops.
+type ttlTranslator struct {
+	gofeed.DefaultRSSTranslator
+}
+
+// Translate translates RSS feed to gofeed.Feed.
+func (t *ttlTranslator) Translate(feed interface{}) (*gofeed.Feed, error) {
+	result, err := t.DefaultRSSTranslator.Translate(feed)
+	if err != nil {
+		return nil, err
+	}
+	if f, ok := feed.(*rss.Feed); ok && f.TTL != "" {
+		if result.Custom == nil {
+			result.Custom = map[string]string{}
+		}
+		result.Custom["ttl"] = f.TTL
+	}
+	return result, nil
+}
+
+// feedPollInterval returns the interval feed declares it is updated at, by the minutes of its <ttl>
+// or by sy:updatePeriod and sy:updateFrequency of the syndication module. Returns zero if it declares none.
+func feedPollInterval(feed *gofeed.Feed) time.Duration {
+	if minutes, err := strconv.Atoi(strings.TrimSpace(feed.Custom["ttl"])); err == nil && minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+
+	sy := feed.Extensions["sy"]
+	period, ok := syndicationPeriods[strings.ToLower(strings.TrimSpace(syndicationValue(sy, "updatePeriod")))]
+	if !ok {
+		return 0
+	}
+	// the frequency is the number of updates per period, defaults to one
+	if frequency, err := strconv.Atoi(strings.TrimSpace(syndicationValue(sy, "updateFrequency"))); err == nil && frequency > 0 {
+		return period / time.Duration(frequency)
+	}
+	return period
+}
+
+// syndicationValue returns the value of the first element name of the syndication module extensions.
+func syndicationValue(sy map[string][]ext.Extension, name string) string {
+	if len(sy[name]) == 0 {
+		return ""
+	}
+	return sy[name][0].Value
+}
@@ -0,0 +1,46 @@
+package rss2telegram
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFeedPollInterval(t *testing.T) {
+	tests := []struct {
+		name    string
+		channel string
+		want    time.Duration
+	}{
+		{"none", "", 0},
+		{"ttl", "<ttl>90</ttl>", 90 * time.Minute},
+		{"invalid ttl", "<ttl>soon</ttl>", 0},
+		{"update period", "<sy:updatePeriod>hourly</sy:updatePeriod>", time.Hour},
+		{"update frequency", "<sy:updatePeriod>daily</sy:updatePeriod><sy:updateFrequency>4</sy:updateFrequency>", 6 * time.Hour},
+		{"unknown period", "<sy:updatePeriod>sometimes</sy:updatePeriod>", 0},
+		{"ttl preferred", "<ttl>30</ttl><sy:updatePeriod>daily</sy:updatePeriod>", 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			xml := `<?xml version="1.0"?><rss version="2.0" xmlns:sy="http://purl.org/rss/1.0/modules/syndication/">` +
+				`<channel><title>Feed</title>` + tt.channel + `</channel></rss>`
+			feed, err := parseFeed(strings.NewReader(xml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := feedPollInterval(feed); got != tt.want {
+				t.Errorf("feedPollInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSummaryFeedPolled(t *testing.T) {
+	var sum Summary
+	for _, d := range []time.Duration{0, time.Hour, 0, 30 * time.Minute, 2 * time.Hour} {
+		sum.feedPolled(d)
+	}
+	if want := 30 * time.Minute; sum.SuggestedPollInterval != want {
+		t.Errorf("SuggestedPollInterval = %v, want %v", sum.SuggestedPollInterval, want)
+	}
+}
@@ -0,0 +1,70 @@
+package rss2telegram
+
+import (
+	"context"
+	"time"
+)
+
+// defaultCrossFeedDedupTTL is the default time links posted to a chat are recorded for.
+const defaultCrossFeedDedupTTL = 72 * time.Hour
+
+// LinkRecorder is implemented by stores recording the links of items posted to each chat by any
+// of its feeds, so an item syndicated by several feeds is posted to the chat once.
+// Unlike the rest of the state, the links are kept per chat rather than per feed.
+type LinkRecorder interface {
+	// ReadPostedLinks returns the times links were posted to chatID keyed by link.
+	ReadPostedLinks(ctx context.Context, chatID string) (map[string]time.Time, error)
+	// WritePostedLinks stores the times links were posted to chatID keyed by link,
+	// replacing the stored ones.
+	WritePostedLinks(ctx context.Context, chatID string, links map[string]time.Time) error
+}
+
+// postedLinks are the links posted to a chat within the dedup TTL, nil when cross-feed dedup is off.
+type postedLinks struct {
+	links   map[string]time.Time
+	changed bool
+}
+
+// readPostedLinks reads the links posted to chatID from recorder, dropping the ones posted
+// more than ttl ago.
+func readPostedLinks(ctx context.Context, recorder LinkRecorder, chatID string, ttl time.Duration) (*postedLinks, error) {
+	links, err := recorder.ReadPostedLinks(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &postedLinks{links: make(map[string]time.Time, len(links))}
+	for link, t := range links {
+		if time.Since(t) < ttl {
+			p.links[link] = t
+		} else {
+			// expired links are dropped from the store on the next write
+			p.changed = true
+		}
+	}
+	return p, nil
+}
+
+// contains reports whether link was posted to the chat. Empty links are never posted.
+func (p *postedLinks) contains(link string) bool {
+	if p == nil || link == "" {
+		return false
+	}
+	_, ok := p.links[postedLinkKey(link)]
+	return ok
+}
+
+// add records link as posted to the chat now.
+func (p *postedLinks) add(link string) {
+	if p == nil || link == "" {
+		return
+	}
+	p.links[postedLinkKey(link)] = time.Now()
+	p.changed = true
+}
+
+// postedLinkKey returns link stripped of the default tracking parameters, so the links
+// of the same article tagged differently by each feed are recorded once.
+func postedLinkKey(link string) string {
+	return stripTrackingParams(link, defaultTrackingParams)
+}
@@ -0,0 +1,67 @@
+package rss2telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// CursorPruner is implemented by stores able to delete the state of feeds that are no longer posted.
+type CursorPruner interface {
+	// PruneCursors deletes the state of all feeds but keepFeedURLs in all telegram chats.
+	// Returns the number of deleted entries.
+	PruneCursors(ctx context.Context, keepFeedURLs []string) (int, error)
+}
+
+// PruneStaleCursors is a background cloud function that deletes the state of feeds removed from
+// RSS_FEED_URL, CONFIG_FILE and FEEDS_JSON, so the state of chats does not grow with every feed ever posted.
+// It is configured with the same environment variables as RSS2Telegram and posts nothing,
+// so it can be scheduled independently of the runs.
+func PruneStaleCursors(ctx context.Context, m PubSubMessage) error {
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	_, err = PruneCursors(ctx, cfg, cfg.feedURLs())
+	return err
+}
+
+// PruneCursors deletes the state of all feeds but keepFeedURLs in all telegram chats
+// of the store selected by cfg. Returns the number of deleted entries.
+func PruneCursors(ctx context.Context, cfg Config, keepFeedURLs []string) (int, error) {
+	if len(keepFeedURLs) == 0 {
+		// an empty list is most likely a misconfiguration, it would delete the state of all feeds
+		return 0, errors.New("prune: no feed urls to keep")
+	}
+
+	keepFeedURLs, err := normalizeFeedURLs(keepFeedURLs)
+	if err != nil {
+		return 0, fmt.Errorf("prune: %v", err)
+	}
+
+	store, err := cfg.store()
+	if err != nil {
+		return 0, err
+	}
+	pruner, ok := store.(CursorPruner)
+	if !ok {
+		return 0, fmt.Errorf("prune: store %T does not support pruning", store)
+	}
+
+	n, err := pruner.PruneCursors(ctx, keepFeedURLs)
+	if err != nil {
+		return n, err
+	}
+	logger.Info("pruned stale cursors", "entries", n)
+
+	return n, nil
+}
+
+// feedSet returns the set of feedURLs.
+func feedSet(feedURLs []string) map[string]bool {
+	set := make(map[string]bool, len(feedURLs))
+	for _, u := range feedURLs {
+		set[u] = true
+	}
+	return set
+}
@@ -0,0 +1,72 @@
+package rss2telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"cloud.google.com/go/functions/metadata"
+)
+
+// defaultMessageTTL is the default time ids of processed Pub/Sub messages are recorded for.
+const defaultMessageTTL = time.Hour
+
+// MessageRecorder is implemented by stores able to record the ids of processed Pub/Sub messages,
+// so messages delivered more than once are processed once.
+type MessageRecorder interface {
+	// RecordMessage records message id for ttl, reports false if it was already recorded within ttl.
+	RecordMessage(ctx context.Context, id string, ttl time.Duration) (bool, error)
+	// ForgetMessage deletes the record of message id, so its redelivery is processed.
+	ForgetMessage(ctx context.Context, id string) error
+}
+
+// messageID returns the id of Pub/Sub message m, falling back to the id of the event
+// of the cloud function. Returns empty string if neither is known, e.g. in local runs.
+func messageID(ctx context.Context, m PubSubMessage) string {
+	if m.MessageID != "" {
+		return m.MessageID
+	}
+	if meta, err := metadata.FromContext(ctx); err == nil {
+		return meta.EventID
+	}
+	return ""
+}
+
+// messagePayload is the JSON payload of a Pub/Sub message overriding the feed and the chat of the run,
+// e.g. {"feedUrl": "https://example.com/feed.xml", "chatId": "@examplechannel"}.
+type messagePayload struct {
+	// FeedURL is the only feed posted in the run if it is set.
+	FeedURL string `json:"feedUrl"`
+	// ChatID is the only chat the feeds are posted to in the run if it is set.
+	ChatID string `json:"chatId"`
+}
+
+// parsePayload returns the payload of Pub/Sub message m. Messages without JSON payload,
+// e.g. of Cloud Scheduler jobs publishing any text, override nothing.
+func parsePayload(m PubSubMessage) messagePayload {
+	var p messagePayload
+	data := bytes.TrimSpace(m.Data)
+	if len(data) == 0 {
+		return p
+	}
+	if err := json.Unmarshal(data, &p); err != nil {
+		logger.Warn("message payload is not JSON, ignoring it", "error", err)
+		return messagePayload{}
+	}
+	return p
+}
+
+// apply overrides the feeds and the chats of cfg with the ones set by p.
+func (p messagePayload) apply(cfg *Config) {
+	if p.FeedURL != "" {
+		cfg.FeedURLs = []string{p.FeedURL}
+		cfg.Feeds = nil
+	}
+	if p.ChatID != "" {
+		cfg.ChatIDs = []string{p.ChatID}
+		for i := range cfg.Feeds {
+			cfg.Feeds[i].ChatIDs = nil
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package rss2telegram
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultRatePerSecond is the default number of messages sent per second to all chats,
+	// telegram limits bots to about 30.
+	defaultRatePerSecond = 30
+	// defaultChatRatePerMinute is the default number of messages sent per minute to a chat,
+	// telegram limits bots to 20 in groups.
+	defaultChatRatePerMinute = 20
+)
+
+// tokenBucket paces events to rate per second, allowing bursts of up to burst events.
+type tokenBucket struct {
+	mu    sync.Mutex
+	rate  float64
+	burst float64
+	// tokens are the events allowed right away, negative if events wait for the bucket to refill.
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns a full tokenBucket of rate events per period with bursts of up to burst events.
+func newTokenBucket(events int, period time.Duration, burst int) *tokenBucket {
+	return &tokenBucket{
+		rate:   float64(events) / period.Seconds(),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait takes a token from the bucket, waiting until it is refilled if it is empty or until ctx is done.
+// The token is reserved before waiting, so concurrent waits are paced one after another.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens--
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	return sleep(ctx, delay)
+}
+
+// rateLimiter paces messages sent to telegram within telegram rate limits,
+// to all chats and to each chat.
+type rateLimiter struct {
+	// global is the bucket of messages to all chats, nil for no limit.
+	global *tokenBucket
+	// chatRate is the number of messages per minute to a chat, zero for no limit.
+	chatRate int
+
+	mu    sync.Mutex
+	chats map[string]*tokenBucket
+}
+
+// newRateLimiter returns rateLimiter of ratePerSecond messages to all chats and chatRatePerMinute
+// messages to each chat, or nil if neither is limited.
+func newRateLimiter(ratePerSecond, chatRatePerMinute int) *rateLimiter {
+	if ratePerSecond == 0 && chatRatePerMinute == 0 {
+		return nil
+	}
+	l := &rateLimiter{chatRate: chatRatePerMinute, chats: map[string]*tokenBucket{}}
+	if ratePerSecond > 0 {
+		l.global = newTokenBucket(ratePerSecond, time.Second, ratePerSecond)
+	}
+	return l
+}
+
+// wait waits until a message may be sent to telegram chat chatID or until ctx is done.
+func (l *rateLimiter) wait(ctx context.Context, chatID string) error {
+	if l.chatRate > 0 {
+		l.mu.Lock()
+		b, ok := l.chats[chatID]
+		if !ok {
+			b = newTokenBucket(l.chatRate, time.Minute, l.chatRate)
+			l.chats[chatID] = b
+		}
+		l.mu.Unlock()
+		if err := b.wait(ctx); err != nil {
+			return err
+		}
+	}
+	if l.global != nil {
+		return l.global.wait(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package rss2telegram
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// waitN waits n times for chat chatID on l and returns the time it took.
+func waitN(t *testing.T, l *rateLimiter, chatID string, n int) time.Duration {
+	t.Helper()
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		if err := l.wait(context.Background(), chatID); err != nil {
+			t.Fatalf("wait %d: %v", i, err)
+		}
+	}
+	return time.Since(start)
+}
+
+func TestRateLimiterGlobal(t *testing.T) {
+	l := newRateLimiter(20, 0)
+
+	// the burst of 20 messages is sent right away, the other 10 are paced 50ms apart
+	got := waitN(t, l, "a", 20)
+	got += waitN(t, l, "b", 10)
+	if want := 450 * time.Millisecond; got < want {
+		t.Errorf("30 messages at 20 per second sent in %v, want at least %v", got, want)
+	}
+}
+
+func TestRateLimiterChat(t *testing.T) {
+	l := newRateLimiter(0, 240)
+
+	if got := waitN(t, l, "a", 240); got > 100*time.Millisecond {
+		t.Errorf("burst of 240 messages sent in %v, want right away", got)
+	}
+	// the other 2 messages are paced 250ms apart
+	if got, want := waitN(t, l, "a", 2), 450*time.Millisecond; got < want {
+		t.Errorf("messages over the burst sent in %v, want at least %v", got, want)
+	}
+	// other chats have buckets of their own
+	if got := waitN(t, l, "b", 10); got > 100*time.Millisecond {
+		t.Errorf("messages to another chat sent in %v, want right away", got)
+	}
+}
+
+func TestRateLimiterCanceled(t *testing.T) {
+	l := newRateLimiter(0, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := l.wait(ctx, "a"); err != nil {
+		t.Fatalf("first wait: %v", err)
+	}
+	if err := l.wait(ctx, "a"); err == nil {
+		t.Error("wait over the limit returned no error, want context error")
+	}
+}
+
+func TestNewRateLimiterNoLimit(t *testing.T) {
+	if l := newRateLimiter(0, 0); l != nil {
+		t.Errorf("newRateLimiter(0, 0) = %v, want nil", l)
+	}
+}
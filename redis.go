@@ -0,0 +1,347 @@
+package rss2telegram
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// redisKeyPrefix is the prefix of keys the state of chats is stored under in redis.
+const redisKeyPrefix = "rss2tg"
+
+var (
+	// redisPools are the global redis connection pools per url, initialized once per instance on first use.
+	redisPools   = map[string]*redis.Pool{}
+	redisPoolsMu sync.Mutex
+)
+
+// redisPool returns the global connection pool of redis server at rawURL.
+func redisPool(rawURL string) *redis.Pool {
+	redisPoolsMu.Lock()
+	defer redisPoolsMu.Unlock()
+
+	if pool, ok := redisPools[rawURL]; ok {
+		return pool
+	}
+
+	pool := &redis.Pool{
+		MaxIdle:     2,
+		IdleTimeout: 5 * time.Minute,
+		DialContext: func(ctx context.Context) (redis.Conn, error) {
+			return redis.DialURLContext(ctx, rawURL)
+		},
+	}
+	redisPools[rawURL] = pool
+
+	return pool
+}
+
+// redisStore is Store keeping the state of feeds in redis keys "rss2tg:{chatID}:{feedURL}",
+// the published time is stored as RFC 3339 timestamp, the rest of the state as JSON
+// in keys with the kind of the state appended.
+type redisStore struct {
+	pool *redis.Pool
+}
+
+// newRedisStore returns redisStore of redis server at rawURL, e.g. "redis://localhost:6379/0".
+func newRedisStore(rawURL string) redisStore {
+	return redisStore{pool: redisPool(rawURL)}
+}
+
+// key returns the redis key of the state of feedURL feed of telegram chat chatID,
+// with kind appended unless it is empty.
+func (s redisStore) key(chatID, feedURL, kind string) string {
+	key := redisKeyPrefix + ":" + chatID + ":" + feedURL
+	if kind != "" {
+		key += ":" + kind
+	}
+	return key
+}
+
+// ReadPublishedAt reads the time feedURL feed was published to telegram chat chatID from redis.
+func (s redisStore) ReadPublishedAt(ctx context.Context, chatID, feedURL string) (time.Time, error) {
+	v, err := s.get(ctx, s.key(chatID, feedURL, ""))
+	if err != nil || v == "" {
+		return time.Time{}, err
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		// value is not a timestamp, return zero time.Time as a default value
+		return time.Time{}, nil
+	}
+
+	return t, nil
+}
+
+// WritePublishedAt writes the time feedURL feed was published to telegram chat chatID to redis.
+func (s redisStore) WritePublishedAt(ctx context.Context, chatID, feedURL string, t time.Time) error {
+	return s.set(ctx, s.key(chatID, feedURL, ""), t.Format(time.RFC3339Nano))
+}
+
+// ReadLastRunAt reads the time feedURL feed of telegram chat chatID was last processed from redis.
+func (s redisStore) ReadLastRunAt(ctx context.Context, chatID, feedURL string) (time.Time, error) {
+	v, err := s.get(ctx, s.key(chatID, feedURL, "lastRunAt"))
+	if err != nil || v == "" {
+		return time.Time{}, err
+	}
+	// value that is not a timestamp is treated as a missing one
+	t, _ := time.Parse(time.RFC3339Nano, v)
+	return t, nil
+}
+
+// WriteLastRunAt writes the time feedURL feed of telegram chat chatID was last processed to redis.
+func (s redisStore) WriteLastRunAt(ctx context.Context, chatID, feedURL string, t time.Time) error {
+	return s.set(ctx, s.key(chatID, feedURL, "lastRunAt"), t.Format(time.RFC3339Nano))
+}
+
+// ReadSeenKeys reads the GUIDs or hashes of feedURL feed items published to telegram chat chatID
+// in dedup mode from redis.
+func (s redisStore) ReadSeenKeys(ctx context.Context, chatID, feedURL, mode string) ([]string, error) {
+	var keys []string
+	err := s.getJSON(ctx, s.key(chatID, feedURL, seenField(mode)), &keys)
+	return keys, err
+}
+
+// WriteSeenKeys writes the GUIDs or hashes of feedURL feed items published to telegram chat chatID
+// in dedup mode to redis.
+func (s redisStore) WriteSeenKeys(ctx context.Context, chatID, feedURL, mode string, keys []string) error {
+	return s.setJSON(ctx, s.key(chatID, feedURL, seenField(mode)), keys)
+}
+
+// ReadFeedCache reads the validators of the last feedURL feed response of telegram chat chatID from redis.
+func (s redisStore) ReadFeedCache(ctx context.Context, chatID, feedURL string) (FeedCache, error) {
+	var cache FeedCache
+	err := s.getJSON(ctx, s.key(chatID, feedURL, "httpCache"), &cache)
+	return cache, err
+}
+
+// WriteFeedCache writes the validators of the last feedURL feed response of telegram chat chatID to redis.
+func (s redisStore) WriteFeedCache(ctx context.Context, chatID, feedURL string, cache FeedCache) error {
+	return s.setJSON(ctx, s.key(chatID, feedURL, "httpCache"), cache)
+}
+
+// ReadRevisions reads the last posted revisions of feedURL feed items of telegram chat chatID from redis.
+func (s redisStore) ReadRevisions(ctx context.Context, chatID, feedURL string) (map[string]ItemRevision, error) {
+	var revisions map[string]ItemRevision
+	err := s.getJSON(ctx, s.key(chatID, feedURL, "revisions"), &revisions)
+	return revisions, err
+}
+
+// WriteRevisions writes the last posted revisions of feedURL feed items of telegram chat chatID to redis.
+func (s redisStore) WriteRevisions(ctx context.Context, chatID, feedURL string, revisions map[string]ItemRevision) error {
+	return s.setJSON(ctx, s.key(chatID, feedURL, "revisions"), revisions)
+}
+
+// redisUnlock deletes the lock key KEYS[1] if it is still held by owner ARGV[1].
+var redisUnlock = redis.NewScript(1, `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`)
+
+// Lock acquires the lock of feedURL feed of telegram chat chatID for lease, the owner of the lock
+// is kept in the key with lock kind expiring after the lease.
+func (s redisStore) Lock(ctx context.Context, chatID, feedURL string, lease time.Duration) (func(context.Context) error, bool, error) {
+	owner, err := lockOwner()
+	if err != nil {
+		return nil, false, err
+	}
+
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer conn.Close()
+
+	key := s.key(chatID, feedURL, "lock")
+	_, err = redis.String(conn.Do("SET", key, owner, "NX", "PX", lease.Milliseconds()))
+	if err == redis.ErrNil {
+		// the lock is held by another run
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	unlock := func(ctx context.Context) error {
+		conn, err := s.pool.GetContext(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		_, err = redisUnlock.Do(conn, key, owner)
+		return err
+	}
+
+	return unlock, true, nil
+}
+
+// linksKey returns the redis key of the links posted to telegram chat chatID.
+func (s redisStore) linksKey(chatID string) string {
+	return redisKeyPrefix + ":links:" + chatID
+}
+
+// ReadPostedLinks reads the times links were posted to telegram chat chatID by any feed from redis.
+func (s redisStore) ReadPostedLinks(ctx context.Context, chatID string) (map[string]time.Time, error) {
+	var links map[string]time.Time
+	err := s.getJSON(ctx, s.linksKey(chatID), &links)
+	return links, err
+}
+
+// WritePostedLinks writes the times links were posted to telegram chat chatID to redis.
+func (s redisStore) WritePostedLinks(ctx context.Context, chatID string, links map[string]time.Time) error {
+	return s.setJSON(ctx, s.linksKey(chatID), links)
+}
+
+// messageKey returns the redis key of processed Pub/Sub message id.
+func (s redisStore) messageKey(id string) string {
+	return redisKeyPrefix + ":message:" + id
+}
+
+// RecordMessage records message id in a key expiring after ttl.
+func (s redisStore) RecordMessage(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	_, err = redis.String(conn.Do("SET", s.messageKey(id), "1", "NX", "PX", ttl.Milliseconds()))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ForgetMessage deletes the key of message id.
+func (s redisStore) ForgetMessage(ctx context.Context, id string) error {
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Do("DEL", s.messageKey(id))
+	return err
+}
+
+// redisKinds are the kinds of the state of feeds appended to the keys of published time.
+var redisKinds = []string{seenField(dedupModeGUID), seenField(dedupModeHash), "httpCache", "revisions", "lock", "lastRunAt"}
+
+// Ping checks the connection to redis.
+func (s redisStore) Ping(ctx context.Context) error {
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Do("PING")
+	return err
+}
+
+// PruneCursors deletes the keys of the state of all feeds but keepFeedURLs of all telegram chats
+// from redis. Chat ids are expected not to contain colons, like telegram chat ids and usernames.
+func (s redisStore) PruneCursors(ctx context.Context, keepFeedURLs []string) (int, error) {
+	keep := feedSet(keepFeedURLs)
+
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	var n int
+	cursor := "0"
+	for {
+		values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", redisKeyPrefix+":*", "COUNT", 100))
+		if err != nil {
+			return n, err
+		}
+		var keys []string
+		if _, err := redis.Scan(values, &cursor, &keys); err != nil {
+			return n, err
+		}
+
+		for _, key := range keys {
+			if keep[redisFeedURL(key)] || strings.HasPrefix(key, redisKeyPrefix+":links:") || strings.HasPrefix(key, redisKeyPrefix+":message:") {
+				// the links posted to chats and the processed Pub/Sub messages are not the state of a feed
+				continue
+			}
+			if _, err := conn.Do("DEL", key); err != nil {
+				return n, err
+			}
+			n++
+		}
+
+		if cursor == "0" {
+			return n, nil
+		}
+	}
+}
+
+// redisFeedURL returns the feed url of redis key of the state of a feed.
+func redisFeedURL(key string) string {
+	rest := strings.TrimPrefix(key, redisKeyPrefix+":")
+	i := strings.IndexByte(rest, ':')
+	if i < 0 {
+		return ""
+	}
+	feedURL := rest[i+1:]
+	for _, kind := range redisKinds {
+		if strings.HasSuffix(feedURL, ":"+kind) {
+			return strings.TrimSuffix(feedURL, ":"+kind)
+		}
+	}
+	return feedURL
+}
+
+// get returns the value of key, empty if the key does not exist.
+func (s redisStore) get(ctx context.Context, key string) (string, error) {
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	v, err := redis.String(conn.Do("GET", key))
+	if err == redis.ErrNil {
+		return "", nil
+	}
+	return v, err
+}
+
+// set sets the value of key.
+func (s redisStore) set(ctx context.Context, key, v string) error {
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Do("SET", key, v)
+	return err
+}
+
+// getJSON decodes the JSON value of key into v, v is left as is if the key does not exist
+// or its value is not valid.
+func (s redisStore) getJSON(ctx context.Context, key string, v interface{}) error {
+	data, err := s.get(ctx, key)
+	if err != nil || data == "" {
+		return err
+	}
+	// invalid value is treated as a missing one, like in other stores
+	_ = json.Unmarshal([]byte(data), v)
+	return nil
+}
+
+// setJSON sets the value of key to JSON encoding of v.
+func (s redisStore) setJSON(ctx context.Context, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.set(ctx, key, string(data))
+}
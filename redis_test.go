@@ -0,0 +1,258 @@
+package rss2telegram
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestRedisFeedURL(t *testing.T) {
+	tests := map[string]string{
+		"rss2tg:1:https://example.com/feed":                  "https://example.com/feed",
+		"rss2tg:@channel:https://example.com/feed:seenGUIDs": "https://example.com/feed",
+		"rss2tg:-100123:https://example.com/feed:httpCache":  "https://example.com/feed",
+		"rss2tg:1:https://example.com/feed:lock":             "https://example.com/feed",
+		"rss2tg:1":                                           "",
+	}
+	for key, want := range tests {
+		if got := redisFeedURL(key); got != want {
+			t.Errorf("redisFeedURL(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+// testRedisStore returns redisStore of the test redis server at REDIS_TEST_URL and a chat id unique
+// to the test, whose keys are deleted at the end of the test. The test is skipped if REDIS_TEST_URL
+// is not set. The tests of pruning delete the state of other chats, so the database should not be
+// shared with a deployment.
+func testRedisStore(t *testing.T) (redisStore, string) {
+	rawURL := os.Getenv("REDIS_TEST_URL")
+	if rawURL == "" {
+		t.Skip("REDIS_TEST_URL not set")
+	}
+	s := newRedisStore(rawURL)
+	ctx := context.Background()
+	if err := s.Ping(ctx); err != nil {
+		t.Fatalf("redis at REDIS_TEST_URL: %v", err)
+	}
+
+	chatID := fmt.Sprintf("test%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		conn, err := s.pool.GetContext(ctx)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		keys, err := redis.Strings(conn.Do("KEYS", redisKeyPrefix+":*"+chatID+"*"))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for _, key := range keys {
+			if _, err := conn.Do("DEL", key); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+	return s, chatID
+}
+
+func TestRedisPublishedAt(t *testing.T) {
+	s, chatID := testRedisStore(t)
+	ctx := context.Background()
+	const feedURL = "https://example.com/feed"
+
+	got, err := s.ReadPublishedAt(ctx, chatID, feedURL)
+	if err != nil || !got.IsZero() {
+		t.Fatalf("ReadPublishedAt() of a new feed = %v, %v, want zero time", got, err)
+	}
+
+	publishedAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := s.WritePublishedAt(ctx, chatID, feedURL, publishedAt); err != nil {
+		t.Fatal(err)
+	}
+	got, err = s.ReadPublishedAt(ctx, chatID, feedURL)
+	if err != nil || !got.Equal(publishedAt) {
+		t.Errorf("ReadPublishedAt() = %v, %v, want %v", got, err, publishedAt)
+	}
+
+	// the time is stored as RFC 3339 timestamp under the key of the chat and the feed
+	v, err := s.get(ctx, "rss2tg:"+chatID+":"+feedURL)
+	if err != nil || v != "2020-01-02T03:04:05Z" {
+		t.Errorf("value of the key = %q, %v, want RFC 3339 timestamp", v, err)
+	}
+}
+
+func TestRedisSubSecondPublishedAt(t *testing.T) {
+	s, chatID := testRedisStore(t)
+	ctx := context.Background()
+	const feedURL = "https://example.com/feed"
+	// like Atom and JSON Feed times with fractional seconds
+	publishedAt := time.Date(2020, 1, 2, 3, 4, 5, 123000000, time.UTC)
+
+	if err := s.WritePublishedAt(ctx, chatID, feedURL, publishedAt); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.ReadPublishedAt(ctx, chatID, feedURL); err != nil || !got.Equal(publishedAt) {
+		t.Errorf("ReadPublishedAt() = %v, %v, want %v", got, err, publishedAt)
+	}
+}
+
+func TestRedisState(t *testing.T) {
+	s, chatID := testRedisStore(t)
+	ctx := context.Background()
+	const feedURL = "https://example.com/feed"
+	at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	keys := []string{"urn:1", "urn:2"}
+	if err := s.WriteSeenKeys(ctx, chatID, feedURL, dedupModeGUID, keys); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.ReadSeenKeys(ctx, chatID, feedURL, dedupModeGUID); err != nil || !reflect.DeepEqual(got, keys) {
+		t.Errorf("ReadSeenKeys() = %v, %v, want %v", got, err, keys)
+	}
+	if got, err := s.ReadSeenKeys(ctx, chatID, feedURL, dedupModeHash); err != nil || len(got) != 0 {
+		t.Errorf("ReadSeenKeys() of hash mode = %v, %v, want none", got, err)
+	}
+
+	cache := FeedCache{ETag: `"v1"`, LastModified: "Mon, 02 Jan 2006 15:04:05 GMT", BodyHash: "abc"}
+	if err := s.WriteFeedCache(ctx, chatID, feedURL, cache); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.ReadFeedCache(ctx, chatID, feedURL); err != nil || got != cache {
+		t.Errorf("ReadFeedCache() = %+v, %v, want %+v", got, err, cache)
+	}
+
+	revisions := map[string]ItemRevision{"urn:1": {UpdatedAt: at, Reposts: 2}}
+	if err := s.WriteRevisions(ctx, chatID, feedURL, revisions); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.ReadRevisions(ctx, chatID, feedURL); err != nil || !reflect.DeepEqual(got, revisions) {
+		t.Errorf("ReadRevisions() = %v, %v, want %v", got, err, revisions)
+	}
+
+	if err := s.WriteLastRunAt(ctx, chatID, feedURL, at); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.ReadLastRunAt(ctx, chatID, feedURL); err != nil || !got.Equal(at) {
+		t.Errorf("ReadLastRunAt() = %v, %v, want %v", got, err, at)
+	}
+
+	links := map[string]time.Time{"https://example.com/1": at}
+	if err := s.WritePostedLinks(ctx, chatID, links); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.ReadPostedLinks(ctx, chatID); err != nil || !reflect.DeepEqual(got, links) {
+		t.Errorf("ReadPostedLinks() = %v, %v, want %v", got, err, links)
+	}
+}
+
+func TestRedisLock(t *testing.T) {
+	s, chatID := testRedisStore(t)
+	ctx := context.Background()
+	const feedURL = "https://example.com/feed"
+
+	unlock, ok, err := s.Lock(ctx, chatID, feedURL, time.Minute)
+	if err != nil || !ok {
+		t.Fatalf("Lock() = %v, %v, want the lock acquired", ok, err)
+	}
+	if _, ok, err := s.Lock(ctx, chatID, feedURL, time.Minute); err != nil || ok {
+		t.Errorf("Lock() of a held lock = %v, %v, want false", ok, err)
+	}
+	if err := unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	unlock, ok, err = s.Lock(ctx, chatID, feedURL, 100*time.Millisecond)
+	if err != nil || !ok {
+		t.Fatalf("Lock() after unlock = %v, %v, want the lock acquired", ok, err)
+	}
+	defer unlock(ctx)
+
+	// the lock expires after the lease
+	time.Sleep(200 * time.Millisecond)
+	unlockAgain, ok, err := s.Lock(ctx, chatID, feedURL, time.Minute)
+	if err != nil || !ok {
+		t.Fatalf("Lock() after the lease = %v, %v, want the lock acquired", ok, err)
+	}
+	// the expired lock does not release the lock of another run
+	if err := unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := s.Lock(ctx, chatID, feedURL, time.Minute); err != nil || ok {
+		t.Errorf("Lock() after unlock of the expired lock = %v, %v, want false", ok, err)
+	}
+	if err := unlockAgain(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRedisRecordMessage(t *testing.T) {
+	s, chatID := testRedisStore(t)
+	ctx := context.Background()
+	id := "message-" + chatID
+
+	if ok, err := s.RecordMessage(ctx, id, time.Minute); err != nil || !ok {
+		t.Fatalf("RecordMessage() = %v, %v, want true", ok, err)
+	}
+	if ok, err := s.RecordMessage(ctx, id, time.Minute); err != nil || ok {
+		t.Errorf("RecordMessage() of a recorded message = %v, %v, want false", ok, err)
+	}
+	if err := s.ForgetMessage(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := s.RecordMessage(ctx, id, time.Minute); err != nil || !ok {
+		t.Errorf("RecordMessage() of a forgotten message = %v, %v, want true", ok, err)
+	}
+}
+
+func TestRedisPruneCursors(t *testing.T) {
+	s, chatID := testRedisStore(t)
+	ctx := context.Background()
+	const keptURL, prunedURL = "https://example.com/kept", "https://example.com/pruned"
+	at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, feedURL := range []string{keptURL, prunedURL} {
+		if err := s.WritePublishedAt(ctx, chatID, feedURL, at); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.WriteSeenKeys(ctx, chatID, feedURL, dedupModeGUID, []string{"urn:1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.WritePostedLinks(ctx, chatID, map[string]time.Time{"https://example.com/1": at}); err != nil {
+		t.Fatal(err)
+	}
+	messageID := "message-" + chatID
+	if _, err := s.RecordMessage(ctx, messageID, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := s.PruneCursors(ctx, []string{keptURL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n < 2 {
+		t.Errorf("PruneCursors() = %d, want at least the 2 keys of the pruned feed", n)
+	}
+	if got, err := s.ReadPublishedAt(ctx, chatID, prunedURL); err != nil || !got.IsZero() {
+		t.Errorf("ReadPublishedAt() of the pruned feed = %v, %v, want zero time", got, err)
+	}
+	if got, err := s.ReadSeenKeys(ctx, chatID, prunedURL, dedupModeGUID); err != nil || len(got) != 0 {
+		t.Errorf("ReadSeenKeys() of the pruned feed = %v, %v, want none", got, err)
+	}
+	if got, err := s.ReadPublishedAt(ctx, chatID, keptURL); err != nil || !got.Equal(at) {
+		t.Errorf("ReadPublishedAt() of the kept feed = %v, %v, want %v", got, err, at)
+	}
+	if got, err := s.ReadPostedLinks(ctx, chatID); err != nil || len(got) != 1 {
+		t.Errorf("ReadPostedLinks() = %v, %v, want the posted links kept", got, err)
+	}
+	if ok, err := s.RecordMessage(ctx, messageID, time.Minute); err != nil || ok {
+		t.Errorf("RecordMessage() after the prune = %v, %v, want the message kept recorded", ok, err)
+	}
+}
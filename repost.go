@@ -0,0 +1,94 @@
+package rss2telegram
+
+import (
+	"context"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const (
+	// maxReposts is the maximum number of reposts of an item, so feeds bumping the updated time
+	// of items on every request do not repost them forever.
+	maxReposts = 3
+	// updatedMarker is appended to the titles of reposted items.
+	updatedMarker = " (updated)"
+)
+
+// ItemRevision is the last posted revision of a feed item.
+type ItemRevision struct {
+	// UpdatedAt is the updated time of the item when it was last posted.
+	UpdatedAt time.Time `firestore:"updatedAt" json:"updatedAt"`
+	// Reposts is the number of times the item was reposted.
+	Reposts int `firestore:"reposts" json:"reposts"`
+}
+
+// repostUpdated reposts feed items already posted to telegram chat chatID whose updated time moved
+// past the one they were last posted with, their titles marked as updated. Items are reposted
+// with a strictly later updated time only, at most maxReposts times. posted reports whether
+// an item was already posted (or filtered out). The revisions are kept for items in the feed only.
+func repostUpdated(ctx context.Context, bot telegramBot, store Store, chatID, rssFeedURL string, feed *gofeed.Feed, opts feedOptions, sum *Summary, posted func(*gofeed.Item) bool) error {
+	revisions, err := store.ReadRevisions(ctx, chatID, rssFeedURL)
+	if err != nil {
+		return err
+	}
+
+	newRevisions := make(map[string]ItemRevision, len(feed.Items))
+	var items, reposts []*gofeed.Item
+	for _, item := range feed.Items {
+		key := itemGUID(item)
+		if key == "" || item.UpdatedParsed == nil || !posted(item) {
+			continue
+		}
+
+		rev, ok := revisions[key]
+		newRevisions[key] = rev
+		switch {
+		case !ok:
+			// the first revision of the item is recorded without reposting
+			newRevisions[key] = ItemRevision{UpdatedAt: *item.UpdatedParsed}
+		case !item.UpdatedParsed.After(rev.UpdatedAt):
+			// the item was not updated since it was last posted
+		case opts.minItemAge > 0 && time.Since(*item.UpdatedParsed) < opts.minItemAge:
+			// the revision is not settled yet, it is reposted on the next runs
+		case rev.Reposts >= maxReposts || !opts.filter.match(item):
+			// the revision is recorded without reposting
+			newRevisions[key] = ItemRevision{UpdatedAt: *item.UpdatedParsed, Reposts: rev.Reposts}
+		default:
+			repost := *item
+			repost.Title += updatedMarker
+			items = append(items, item)
+			reposts = append(reposts, &repost)
+		}
+	}
+
+	for i, err := range sendItems(ctx, bot, chatID, reposts, opts, false) {
+		if err != nil {
+			itemLogger(rssFeedURL, chatID, items[i]).Error("item failed", "error", err)
+			sum.itemFailed(err)
+			continue
+		}
+		key := itemGUID(items[i])
+		newRevisions[key] = ItemRevision{UpdatedAt: *items[i].UpdatedParsed, Reposts: revisions[key].Reposts + 1}
+		itemLogger(rssFeedURL, chatID, items[i]).Info("item reposted")
+		sum.ItemsSent++
+	}
+
+	if opts.dryRun || revisionsEqual(revisions, newRevisions) {
+		return nil
+	}
+	return store.WriteRevisions(ctx, chatID, rssFeedURL, newRevisions)
+}
+
+// revisionsEqual reports whether revisions a and b are the same.
+func revisionsEqual(a, b map[string]ItemRevision) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, rev := range a {
+		if other, ok := b[key]; !ok || other.Reposts != rev.Reposts || !other.UpdatedAt.Equal(rev.UpdatedAt) {
+			return false
+		}
+	}
+	return true
+}
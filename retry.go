@@ -0,0 +1,77 @@
+package rss2telegram
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// retryPolicy is the policy of retrying requests failed with transient errors.
+type retryPolicy struct {
+	// maxRetries is the number of retries after the first attempt, zero means no retries.
+	maxRetries int
+	// baseDelay is the delay before the first retry, doubled for each next one.
+	baseDelay time.Duration
+}
+
+// transientError is an error of a request that may succeed if repeated,
+// e.g. a network error or 5xx response.
+type transientError struct {
+	err error
+}
+
+func (e transientError) Error() string {
+	return e.err.Error()
+}
+
+// transient marks err as transient, unless it is caused by the context being done.
+func transient(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return err
+	}
+	return transientError{err}
+}
+
+// isTransient reports whether err is transient.
+func isTransient(err error) bool {
+	var t transientError
+	return errors.As(err, &t)
+}
+
+// do calls f until it succeeds, fails with a non-transient error or the retries are exhausted.
+// Retries are delayed with exponential backoff and jitter, waiting stops when ctx is done.
+func (p retryPolicy) do(ctx context.Context, f func() error) error {
+	for retry := 0; ; retry++ {
+		err := f()
+		if err == nil || !isTransient(err) || retry >= p.maxRetries {
+			return err
+		}
+
+		delay := p.delay(retry)
+		logger.Warn("retrying", "error", err, "delay", delay)
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// delay returns the delay before retry, a random duration between the half and the whole
+// of the base delay doubled retry times.
+func (p retryPolicy) delay(retry int) time.Duration {
+	d := p.baseDelay << uint(retry)
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,50 @@
+package rss2telegram
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDo(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name    string
+		errs    []error
+		calls   int
+		wantErr error
+	}{
+		{"succeeded", []error{nil}, 1, nil},
+		{"transient once", []error{transientError{errFailed}, nil}, 2, nil},
+		{"transient always", []error{transientError{errFailed}}, 3, transientError{errFailed}},
+		{"not transient", []error{errFailed, nil}, 1, errFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retry := retryPolicy{maxRetries: 2, baseDelay: time.Millisecond}
+			var calls int
+			err := retry.do(context.Background(), func() error {
+				calls++
+				return tt.errs[min(calls, len(tt.errs))-1]
+			})
+			if err != tt.wantErr || calls != tt.calls {
+				t.Errorf("do() = %v after %d calls, want %v after %d", err, calls, tt.wantErr, tt.calls)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	retry := retryPolicy{baseDelay: time.Second}
+	for i := 0; i < 4; i++ {
+		// the delay is doubled for each next retry, jittered down to its half
+		d, limit := retry.delay(i), time.Second<<uint(i)
+		if d < limit/2 || d > limit {
+			t.Errorf("delay(%d) = %v, want between %v and %v", i, d, limit/2, limit)
+		}
+	}
+	if d := (retryPolicy{}).delay(1); d != 0 {
+		t.Errorf("delay of zero base delay = %v, want 0", d)
+	}
+}
@@ -2,190 +2,757 @@ package rss2telegram
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
 
-	"cloud.google.com/go/firestore"
-	md "github.com/Skarlso/html-to-markdown"
 	"github.com/mmcdole/gofeed"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/sync/errgroup"
 )
 
-var (
-	// projectID is set from the GCP_PROJECT environment variable, which is
-	// automatically set by the Cloud Functions runtime.
-	projectID = os.Getenv("GCP_PROJECT")
-	// client is a global Firestore client, initialized once per instance.
-	client    *firestore.Client
-	converter = md.NewConverter("", true, &md.Options{
-		StrongDelimiter: "*",
-	})
+const (
+	// dedupModeTime deduplicates items by the published time of the feed.
+	dedupModeTime = "time"
+	// dedupModeGUID deduplicates items by the GUIDs of already published items.
+	dedupModeGUID = "guid"
+	// dedupModeHash deduplicates items by the hashes of titles and links of already published items.
+	dedupModeHash = "hash"
+	// maxSeenItems is the number of the latest published GUIDs or hashes kept per feed.
+	maxSeenItems = 500
 )
 
-func init() {
-	// err is pre-declared to avoid shadowing client.
-	var err error
+// PubSubMessage is the payload of a Pub/Sub event.
+type PubSubMessage struct {
+	// Data is the payload of the message.
+	Data []byte `json:"data"`
+	// Attributes are the attributes of the message.
+	Attributes map[string]string `json:"attributes"`
+	// MessageID is the id of the message, the id of the event is used if it is not set.
+	MessageID string `json:"messageId"`
+	// PublishTime is the time the message was published.
+	PublishTime time.Time `json:"publishTime"`
+}
+
+// RSS2Telegram is a background cloud function that retrives RSS feeds and post updates to telegram.
+// It is configured with environment variables, see ConfigFromEnv, the feed and the chat may be
+// overridden by the JSON payload of the message, e.g. {"feedUrl": "...", "chatId": "..."}.
+// Messages delivered more than once within Config.MessageTTL are processed once if the store
+// is MessageRecorder, redeliveries of messages whose runs failed are processed again.
+func RSS2Telegram(ctx context.Context, m PubSubMessage) error {
+	cfg, err := configFromEnv(parsePayload(m))
+	if err != nil {
+		return err
+	}
 
-	// client is initialized with context.Background() because it should
-	// persist between function invocations.
-	client, err = firestore.NewClient(context.Background(), projectID)
+	id := messageID(ctx, m)
+	store, err := cfg.store()
 	if err != nil {
-		log.Fatalf("firestore.NewClient: %v", err)
+		return err
+	}
+	recorder, ok := store.(MessageRecorder)
+	if ok && id != "" && !cfg.DryRun {
+		first, err := recorder.RecordMessage(ctx, id, orDuration(cfg.MessageTTL, defaultMessageTTL))
+		if err != nil {
+			return fmt.Errorf("recording message %s: %v", id, err)
+		}
+		if !first {
+			logger.Info("message already processed, skipping", "message_id", id, "publish_time", m.PublishTime)
+			return nil
+		}
+	}
+	// the store is reused by the run
+	cfg.Store = store
+
+	_, err = RunWithConfig(ctx, cfg)
+	if err != nil && recorder != nil && id != "" && !cfg.DryRun {
+		if err := recorder.ForgetMessage(ctx, id); err != nil {
+			logger.Warn("forgetting message", "message_id", id, "error", err)
+		}
 	}
+	return err
 }
 
-// PubSubMessage is the payload of a Pub/Sub event.
-type PubSubMessage struct{}
+// HTTPHandler is an HTTP cloud function that retrives RSS feeds and post updates to telegram,
+// e.g. when triggered by Cloud Scheduler. It is configured with environment variables, see ConfigFromEnv.
+// Responds with JSON summary of the run, with 500 status code and the error if the run failed.
+// Only requests to / run the function, requests to /metrics are responded with prometheus metrics,
+// requests to /healthz with the result of CheckHealth, requests to /status with FeedStatuses
+// and requests to other paths (e.g. /favicon.ico of browsers) with 404 status code.
+func HTTPHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/":
+	case "/metrics":
+		promhttp.Handler().ServeHTTP(w, r)
+		return
+	case "/healthz":
+		serveHealth(w, r)
+		return
+	case "/status":
+		serveStatus(w, r)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
 
-// RSS2Telegram is a background cloud function that retrives RSS feed and post updates to telegram.
-// Uses such environment variables:
-// - RSS_FEED_URL
-// - TELEGRAM_BOT_API_TOKEN
-// - TELEGRAM_CHAT_ID
-func RSS2Telegram(ctx context.Context, m PubSubMessage) error {
-	rssFeedURL := os.Getenv("RSS_FEED_URL")
-	if rssFeedURL == "" {
-		return errors.New("environment variable RSS_FEED_URL not set")
+	var resp struct {
+		Summary
+		Error string `json:"error,omitempty"`
+	}
+
+	cfg, err := ConfigFromEnv()
+	if err == nil {
+		resp.Summary, err = RunWithConfig(r.Context(), cfg)
+	}
+
+	code := http.StatusOK
+	if err != nil {
+		logger.Error("run failed", "error", err)
+		resp.Error = err.Error()
+		code = http.StatusInternalServerError
 	}
-	tBotAPIToken := os.Getenv("TELEGRAM_BOT_API_TOKEN")
-	if tBotAPIToken == "" {
-		return errors.New("environment variable TELEGRAM_BOT_API_TOKEN not set")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Error("writing response", "error", err)
+	}
+}
+
+// RunWithConfig retrieves feeds and post updates to telegram according to cfg.
+// Returns the summary of the run, and an error if cfg is invalid or all the feeds failed.
+func RunWithConfig(ctx context.Context, cfg Config) (Summary, error) {
+	var sum Summary
+	defer func() {
+		recordMetrics(sum)
+	}()
+
+	bot, opts, err := cfg.settings()
+	if err != nil {
+		return sum, err
 	}
-	tChatID := os.Getenv("TELEGRAM_CHAT_ID")
-	if tChatID == "" {
-		return errors.New("environment variable TELEGRAM_CHAT_ID not set")
+	logLevel.Set(opts.logLevel)
+
+	routes, err := cfg.routes(bot, opts)
+	if err != nil {
+		return sum, err
 	}
 
-	// create new feed parser and parse provided rss feed url
-	fp := gofeed.NewParser()
-	feed, err := fp.ParseURL(rssFeedURL)
+	store, err := cfg.store()
+	if err != nil {
+		return sum, err
+	}
+
+	if cfg.ValidateOnStart {
+		// every bot of the pool posts to every chat
+		for _, b := range bot.all() {
+			if err := validateBot(ctx, b, routeChats(routes)); err != nil {
+				return sum, err
+			}
+		}
+	}
+
+	if !opts.activeHours.contains(time.Now()) {
+		// items are kept in the feeds and posted once the active hours begin
+		logger.Info("outside of active hours, skipping the run")
+		return sum, nil
+	}
+
+	recorder, _ := store.(RunRecorder)
+	for _, r := range routes {
+		if err := ctx.Err(); err != nil {
+			// the function is shutting down, the rest of feeds is processed on the next run
+			return sum, err
+		}
+
+		if err := processFeed(ctx, r.bot, store, r.chatID, r.feedURL, r.opts, &sum); err != nil {
+			// log the error and continue with the rest of the feeds and chats
+			feedLogger(r.feedURL, r.chatID).Error("feed failed", "error", err)
+			sum.feedFailed(fmt.Errorf("feed %s, chat %s: %v", r.feedURL, r.chatID, err))
+			continue
+		}
+
+		if recorder != nil && !cfg.DryRun {
+			if err := recorder.WriteLastRunAt(ctx, r.chatID, r.feedURL, time.Now()); err != nil {
+				// the feed was processed anyway, so the run does not fail
+				feedLogger(r.feedURL, r.chatID).Warn("recording last run time", "error", err)
+			}
+		}
+	}
+
+	if cfg.AdminChatID != "" {
+		reportToAdmin(ctx, bot, cfg.AdminChatID, sum)
+	}
+
+	if sum.FeedsFailed == len(routes) {
+		return sum, fmt.Errorf("all %d feeds failed, first error: %v", sum.FeedsFailed, sum.firstErr)
+	}
+
+	return sum, nil
+}
+
+// feedOptions holds the settings of processing a feed.
+type feedOptions struct {
+	// client is the http client used to retrieve the feed.
+	client *http.Client
+	// userAgent is the User-Agent header of feed requests.
+	userAgent string
+	// username and password are the credentials of basic auth of the feed, if set.
+	username, password string
+	// headers are the headers set on feed requests, their values are secrets kept out of logs.
+	headers map[string]string
+	// maxFeedBytes is the maximum size of the feed.
+	maxFeedBytes int
+	// retry is the policy of retrying requests failed with transient errors.
+	retry retryPolicy
+	// dedupMode is the way items that were already posted are detected.
+	dedupMode string
+	// filter selects items to post.
+	filter itemFilter
+	// maxItems is the maximum number of items posted in a single run, zero means unlimited.
+	maxItems int
+	// logLevel is the minimum level of logged events.
+	logLevel slog.Level
+	// concurrency is the number of items sent at a time.
+	concurrency int
+	// sendDelay is the pause after sending an item before the next one is sent.
+	sendDelay time.Duration
+	// digest posts the new items of a run as a single message of their titles and links.
+	digest bool
+	// feedTitlePrefix prepends the feed title to messages.
+	feedTitlePrefix bool
+	// feedImage posts items without an image as the feed image.
+	feedImage bool
+	// backfill posts the items already in the feed on the first run, otherwise they are only recorded.
+	backfill bool
+	// repostUpdated reposts already posted items whose updated time moved forward.
+	repostUpdated bool
+	// autoTitlePrefix strips the feed title from item titles if all of them start with it.
+	autoTitlePrefix bool
+	// lockLease is the time the feed of a chat stays locked by a run that did not unlock it.
+	lockLease time.Duration
+	// activeHours is the window of hours of the day items are posted in.
+	activeHours hourWindow
+	// minItemAge is the minimum age of an item to be posted, so edits right after publishing settle.
+	minItemAge time.Duration
+	// minItemDate is the time items published before are not posted, zero for no cutoff.
+	minItemDate time.Time
+	// crossFeedDedup skips items whose links were posted to the chat by any feed within crossFeedDedupTTL.
+	crossFeedDedup    bool
+	crossFeedDedupTTL time.Duration
+	// resolveCanonical posts the canonical urls of articles instead of the links of items,
+	// fetching each article for up to canonicalTimeout.
+	resolveCanonical bool
+	canonicalTimeout time.Duration
+	// posted are the links posted to the chat of the feed being processed, nil if crossFeedDedup is off.
+	posted *postedLinks
+	// dryRun keeps the state of the feed in firestore intact.
+	dryRun bool
+}
+
+// processFeed retrieves rssFeedURL feed and posts its new items to telegram chat chatID.
+// The feed is requested conditionally and not processed if it was not modified since the previous run.
+// If store is Locker, the feed is locked for the run and skipped if another run holds the lock.
+func processFeed(ctx context.Context, bot telegramBot, store Store, chatID, rssFeedURL string, opts feedOptions, sum *Summary) error {
+	// concurrent runs of stores supporting locks skip the feed instead of posting its items twice,
+	// the dry run keeps the state intact so it does not lock
+	if locker, ok := store.(Locker); ok && !opts.dryRun {
+		unlock, ok, err := locker.Lock(ctx, chatID, rssFeedURL, opts.lockLease)
+		if err != nil {
+			return fmt.Errorf("locking feed: %v", err)
+		}
+		if !ok {
+			feedLogger(rssFeedURL, chatID).Info("feed is locked by another run, skipping")
+			return nil
+		}
+		defer func() {
+			if err := unlock(ctx); err != nil {
+				// the lock expires after the lease anyway
+				feedLogger(rssFeedURL, chatID).Warn("unlocking feed", "error", err)
+			}
+		}()
+	}
+
+	// read the validators of the previous feed response from firestore
+	cache, err := store.ReadFeedCache(ctx, chatID, rssFeedURL)
 	if err != nil {
 		return err
 	}
 
-	// read the previous published time of the feed from firestore
-	publishedAt, err := readPublishedAt(ctx, client, tChatID, rssFeedURL)
+	var feed *gofeed.Feed
+	var newCache FeedCache
+	err = opts.retry.do(ctx, func() error {
+		var err error
+		feed, newCache, err = fetchFeed(ctx, opts, rssFeedURL, cache)
+		return err
+	})
 	if err != nil {
 		return err
 	}
+	if feed == nil {
+		// feed was not modified since the previous run, the validators of the response may be new though
+		if newCache != cache && !opts.dryRun {
+			return store.WriteFeedCache(ctx, chatID, rssFeedURL, newCache)
+		}
+		return nil
+	}
+	sum.ItemsFetched += len(feed.Items)
+	sum.feedPolled(feedPollInterval(feed))
+	feed.Items = chronological(feed.Items)
 
-	var newPublishedAt time.Time
+	// bot is a copy, so the feed branding does not leak to other feeds
+	if opts.feedTitlePrefix {
+		bot.message.feedTitle = strings.TrimSpace(feed.Title)
+	}
+	if opts.feedImage && feed.Image != nil {
+		bot.feedImage = feed.Image.URL
+	}
+	if opts.autoTitlePrefix {
+		bot.message.titlePrefix = commonTitlePrefix(feed)
+	}
+
+	// opts is a copy, so the links of the chat do not leak to other chats
+	recorder, ok := store.(LinkRecorder)
+	if opts.crossFeedDedup && ok {
+		if opts.posted, err = readPostedLinks(ctx, recorder, chatID, opts.crossFeedDedupTTL); err != nil {
+			return fmt.Errorf("reading posted links: %v", err)
+		}
+	}
+
+	failed, left := sum.ItemsFailed, sum.itemsLeft
+	switch opts.dedupMode {
+	case dedupModeGUID:
+		err = processFeedBySeen(ctx, bot, store, chatID, rssFeedURL, feed, opts, sum, itemGUID)
+	case dedupModeHash:
+		err = processFeedBySeen(ctx, bot, store, chatID, rssFeedURL, feed, opts, sum, itemHash)
+	default:
+		err = processFeedByTime(ctx, bot, store, chatID, rssFeedURL, feed, opts, sum)
+	}
+	if err != nil {
+		return err
+	}
+
+	if opts.posted != nil && opts.posted.changed && !opts.dryRun {
+		if err := recorder.WritePostedLinks(ctx, chatID, opts.posted.links); err != nil {
+			// the items were posted and the cursor moved anyway, so the feed does not fail
+			feedLogger(rssFeedURL, chatID).Warn("recording posted links", "error", err)
+		}
+	}
+
+	if sum.ItemsFailed > failed || sum.itemsLeft > left {
+		// items failed to send, over the limit of the run or not settled yet are posted by the next runs,
+		// so the previous validators are kept and the feed is processed again even if it does not change
+		newCache = cache
+	}
+
+	if newCache != cache && !opts.dryRun {
+		// write the validators of the feed response to the store
+		return store.WriteFeedCache(ctx, chatID, rssFeedURL, newCache)
+	}
+
+	return nil
+}
+
+// processFeedByTime posts feed items published after the previous published time of the feed.
+func processFeedByTime(ctx context.Context, bot telegramBot, store Store, chatID, rssFeedURL string, feed *gofeed.Feed, opts feedOptions, sum *Summary) error {
+	// read the previous published time of the feed from the store
+	publishedAt, err := store.ReadPublishedAt(ctx, chatID, rssFeedURL)
+	if err != nil {
+		return err
+	}
+
+	if publishedAt.IsZero() && !opts.backfill {
+		// the feed was never posted, record its latest item so only the items published after it are posted
+		for _, item := range feed.Items {
+			if t := itemPublishedAt(item); t != nil {
+				publishedAt = latest(publishedAt, *t)
+			}
+		}
+		feedLogger(rssFeedURL, chatID).Info("first run, feed recorded without posting", "items", len(feed.Items))
+		if publishedAt.IsZero() || opts.dryRun {
+			return nil
+		}
+		return store.WritePublishedAt(ctx, chatID, rssFeedURL, publishedAt)
+	}
 
-	// iterate over feed in reverse order so processing is from older to newer
-	for i := len(feed.Items) - 1; 0 <= i; i-- {
-		if feed.Items[i].PublishedParsed == nil {
-			// skip items without pubslied time
+	// passed holds the times of sent and filtered out items the cursor may be advanced past
+	var passed []time.Time
+	var items []*gofeed.Item
+
+	// items are sorted from older to newer
+	for _, item := range feed.Items {
+		if opts.maxItems > 0 && len(items) >= opts.maxItems {
+			// the rest of items is posted on the next run
+			sum.itemsLeft++
+			break
+		}
+
+		itemTime := itemPublishedAt(item)
+		if itemTime == nil {
+			// skip items without pubslied or updated time
 			continue
 		}
 
-		if !feed.Items[i].PublishedParsed.After(publishedAt) {
+		if !itemTime.After(publishedAt) {
 			// skip item that was published before the previous published time of the feed
 			continue
 		}
 
-		newPublishedAt = *feed.Items[i].PublishedParsed
+		if opts.tooNew(item) {
+			// skip item that is not settled yet, the cursor is not advanced past it
+			sum.itemsLeft++
+			continue
+		}
+
+		if opts.tooOld(item) {
+			// skip item published before the cutoff, the cursor is not moved
+			continue
+		}
+
+		if !opts.filter.match(item) {
+			// skip filtered out item, the cursor is still advanced past it
+			passed = append(passed, *itemTime)
+			itemLogger(rssFeedURL, chatID, item).Debug("item filtered")
+			sum.ItemsFiltered++
+			continue
+		}
+
+		if opts.posted.contains(item.Link) {
+			// skip item posted to the chat by another feed, the cursor is still advanced past it
+			passed = append(passed, *itemTime)
+			itemLogger(rssFeedURL, chatID, item).Info("item already posted by another feed")
+			sum.ItemsFiltered++
+			continue
+		}
+
+		items = append(items, item)
+	}
+
+	// the items after the first failed one are not sent, so they are posted in order on the next run
+	var failedAt *time.Time
+	for i, err := range sendItems(ctx, bot, chatID, items, opts, true) {
+		if err == errNotSent {
+			continue
+		}
+		if err != nil {
+			itemLogger(rssFeedURL, chatID, items[i]).Error("item failed", "error", err)
+			sum.itemFailed(err)
+			if t := itemPublishedAt(items[i]); failedAt == nil || t.Before(*failedAt) {
+				failedAt = t
+			}
+			continue
+		}
+		passed = append(passed, *itemPublishedAt(items[i]))
+		opts.posted.add(items[i].Link)
+		itemLogger(rssFeedURL, chatID, items[i]).Info("item sent")
+		sum.ItemsSent++
+	}
 
-		if err := sendToTelegram(tBotAPIToken, tChatID, feed.Items[i]); err != nil {
-			log.Println(err)
+	// advance the cursor to the latest sent or filtered out item before the first failed one
+	var newPublishedAt time.Time
+	for _, t := range passed {
+		if failedAt == nil || t.Before(*failedAt) {
+			newPublishedAt = latest(newPublishedAt, t)
 		}
 	}
 
-	if !newPublishedAt.IsZero() {
-		// write the feed published time to firestore
-		if err := writePublishedAt(ctx, client, tChatID, rssFeedURL, newPublishedAt); err != nil {
+	if !newPublishedAt.IsZero() && !opts.dryRun {
+		// write the feed published time to the store
+		if err := store.WritePublishedAt(ctx, chatID, rssFeedURL, newPublishedAt); err != nil {
 			return err
 		}
 	}
 
+	if opts.repostUpdated {
+		// items published up to the cursor were already posted or filtered out
+		cursor := latest(publishedAt, newPublishedAt)
+		return repostUpdated(ctx, bot, store, chatID, rssFeedURL, feed, opts, sum, func(item *gofeed.Item) bool {
+			t := itemPublishedAt(item)
+			return t != nil && !t.After(cursor)
+		})
+	}
+
 	return nil
 }
 
-// readPublishedAt reads the time rssURL feed was published to telegram chat chatID from firestore.
-func readPublishedAt(ctx context.Context, client *firestore.Client, chatID, rssURL string) (time.Time, error) {
-	dsnap, err := client.Collection("chats").Doc(chatID).Get(ctx)
-	if status.Code(err) == codes.NotFound {
-		// collection or doc not found, feed was never published
-		return time.Time{}, nil
-	}
+// processFeedBySeen posts feed items whose keys were not seen before. The keys of already
+// published items are stored per dedup mode.
+func processFeedBySeen(ctx context.Context, bot telegramBot, store Store, chatID, rssFeedURL string, feed *gofeed.Feed, opts feedOptions, sum *Summary, itemKey func(*gofeed.Item) string) error {
+	// read the keys of already published items from the store
+	keys, err := store.ReadSeenKeys(ctx, chatID, rssFeedURL, opts.dedupMode)
 	if err != nil {
-		return time.Time{}, err
+		return err
 	}
 
-	data, err := dsnap.DataAtPath([]string{"publishedAt", rssURL})
-	if err != nil {
-		// data at path "publishedAt" not found, feed was never published
-		return time.Time{}, nil
+	if len(keys) == 0 && !opts.backfill {
+		// the feed was never posted, record its items as seen so only the new ones are posted
+		for _, item := range feed.Items {
+			if key := itemKey(item); key != "" {
+				keys = append(keys, key)
+			}
+		}
+		feedLogger(rssFeedURL, chatID).Info("first run, feed recorded without posting", "items", len(feed.Items))
+		if len(keys) == 0 || opts.dryRun {
+			return nil
+		}
+		if len(keys) > maxSeenItems {
+			keys = keys[len(keys)-maxSeenItems:]
+		}
+		return store.WriteSeenKeys(ctx, chatID, rssFeedURL, opts.dedupMode, keys)
 	}
 
-	t, ok := data.(time.Time)
-	if !ok {
-		// data is not time.Time, return zero time.Time as a default value
-		return time.Time{}, nil
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		seen[key] = true
 	}
 
-	return t, nil
-}
+	var changed bool
+	var items []*gofeed.Item
 
-// writePublishedAt writes the time rssURL feed was published to telegram chat chatID from firestore.
-func writePublishedAt(ctx context.Context, client *firestore.Client, chatID, rssURL string, t time.Time) error {
-	doc := client.Collection("chats").Doc(chatID)
-	_, err := doc.Update(ctx, []firestore.Update{{
-		FieldPath: []string{"publishedAt", rssURL},
-		Value:     t,
-	}})
+	// items are sorted from older to newer
+	for _, item := range feed.Items {
+		if opts.maxItems > 0 && len(items) >= opts.maxItems {
+			// the rest of items is posted on the next run
+			sum.itemsLeft++
+			break
+		}
 
-	if err != nil {
-		if status.Code(err) == codes.NotFound {
-			// collection or doc not found, create a doc
-			_, err = doc.Set(ctx, map[string]interface{}{
-				"publishedAt": map[string]interface{}{
-					rssURL: t,
-				},
-			})
+		key := itemKey(item)
+		if key == "" {
+			// skip items without a key, e.g. without guid or link
+			continue
+		}
+
+		if seen[key] {
+			// skip item that was already published
+			continue
+		}
+
+		if opts.tooNew(item) {
+			// skip item that is not settled yet, it is not recorded as seen
+			sum.itemsLeft++
+			continue
+		}
+
+		if opts.tooOld(item) {
+			// skip item published before the cutoff, it is not recorded as seen
+			continue
+		}
+		seen[key] = true
+
+		if !opts.filter.match(item) {
+			// skip filtered out item, it is still recorded as seen
+			keys = append(keys, key)
+			itemLogger(rssFeedURL, chatID, item).Debug("item filtered")
+			sum.ItemsFiltered++
+			changed = true
+			continue
 		}
 
+		if opts.posted.contains(item.Link) {
+			// skip item posted to the chat by another feed, it is still recorded as seen
+			keys = append(keys, key)
+			itemLogger(rssFeedURL, chatID, item).Info("item already posted by another feed")
+			sum.ItemsFiltered++
+			changed = true
+			continue
+		}
+
+		items = append(items, item)
+	}
+
+	// record successfully sent items as seen
+	for i, err := range sendItems(ctx, bot, chatID, items, opts, false) {
 		if err != nil {
+			itemLogger(rssFeedURL, chatID, items[i]).Error("item failed", "error", err)
+			sum.itemFailed(err)
+			continue
+		}
+		keys = append(keys, itemKey(items[i]))
+		opts.posted.add(items[i].Link)
+		itemLogger(rssFeedURL, chatID, items[i]).Info("item sent")
+		changed = true
+		sum.ItemsSent++
+	}
+
+	if changed && !opts.dryRun {
+		// only the last maxSeenItems are kept to avoid unbounded state growth
+		if len(keys) > maxSeenItems {
+			keys = keys[len(keys)-maxSeenItems:]
+		}
+		if err := store.WriteSeenKeys(ctx, chatID, rssFeedURL, opts.dedupMode, keys); err != nil {
 			return err
 		}
 	}
 
+	if opts.repostUpdated {
+		posted := make(map[string]bool, len(keys))
+		for _, key := range keys {
+			posted[key] = true
+		}
+		return repostUpdated(ctx, bot, store, chatID, rssFeedURL, feed, opts, sum, func(item *gofeed.Item) bool {
+			return posted[itemKey(item)]
+		})
+	}
+
 	return nil
 }
 
-func sendToTelegram(botAPIToken, chatID string, item *gofeed.Item) error {
-	content, err := converter.ConvertString(item.Content)
-	if err != nil {
-		log.Println(err)
-		content = item.Content
+// hourWindow is a window of hours of the day in location, from start up to but not including end.
+// A window with start after end spans midnight, a window with equal hours spans the whole day.
+type hourWindow struct {
+	start, end int
+	location   *time.Location
+}
+
+// contains reports whether t is in the window.
+func (w hourWindow) contains(t time.Time) bool {
+	if w.start == w.end {
+		return true
+	}
+	if w.location != nil {
+		t = t.In(w.location)
+	}
+	h := t.Hour()
+	if w.start < w.end {
+		return w.start <= h && h < w.end
 	}
+	return w.start <= h || h < w.end
+}
+
+// tooNew reports whether item was published less than opts.minItemAge ago.
+// Items without published or updated time are never too new.
+func (opts feedOptions) tooNew(item *gofeed.Item) bool {
+	t := itemPublishedAt(item)
+	return opts.minItemAge > 0 && t != nil && time.Since(*t) < opts.minItemAge
+}
+
+// tooOld reports whether item was published before opts.minItemDate.
+// Items without published or updated time are never too old.
+func (opts feedOptions) tooOld(item *gofeed.Item) bool {
+	t := itemPublishedAt(item)
+	return !opts.minItemDate.IsZero() && t != nil && t.Before(opts.minItemDate)
+}
+
+// errNotSent is the error of items that were not sent because sending of a previous item failed.
+var errNotSent = errors.New("not sent after a previous item failed")
 
-	text := fmt.Sprintf("*%s*\n\n%s", item.Title, content)
+// sendItems posts items to telegram chat chatID, sending up to opts.concurrency items at a time
+// and pausing for opts.sendDelay after each item to stay under telegram rate limits.
+// The items link to their canonical urls if opts.resolveCanonical is set.
+// If stopOnError is set, the items not started yet are not sent once sending of an item fails.
+// In digest mode items are posted as a single digest, so all of them share its error.
+// Returns the errors of sending each item, nil for successfully sent ones.
+func sendItems(ctx context.Context, bot telegramBot, chatID string, items []*gofeed.Item, opts feedOptions, stopOnError bool) []error {
+	errs := make([]error, len(items))
 
-	resp, err := http.PostForm(fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", botAPIToken), map[string][]string{
-		"chat_id":                  {chatID},
-		"text":                     {text},
-		"parse_mode":               {"markdown"},
-		"disable_web_page_preview": {"true"},
+	if opts.digest {
+		if len(items) > 0 {
+			canonical := make([]*gofeed.Item, len(items))
+			for i, item := range items {
+				canonical[i] = withCanonicalURL(ctx, opts, item)
+			}
+			err := sendDigest(ctx, bot, chatID, canonical)
+			for i := range errs {
+				errs[i] = err
+			}
+		}
+		return errs
+	}
+
+	var failed int32
+	var g errgroup.Group
+	g.SetLimit(opts.concurrency)
+	for i := range items {
+		i := i
+		g.Go(func() error {
+			if stopOnError && atomic.LoadInt32(&failed) != 0 {
+				errs[i] = errNotSent
+				return nil
+			}
+			if errs[i] = ctx.Err(); errs[i] == nil {
+				errs[i] = sendToTelegram(ctx, bot, chatID, withCanonicalURL(ctx, opts, items[i]))
+			}
+			if errs[i] != nil {
+				atomic.StoreInt32(&failed, 1)
+				return nil
+			}
+			if opts.sendDelay > 0 && i < len(items)-1 {
+				// the slot is held during the pause, so the next item waits for it
+				sleep(ctx, opts.sendDelay)
+			}
+			return nil
+		})
+	}
+	g.Wait()
+
+	return errs
+}
+
+// chronological returns items sorted from older to newer by their published time.
+// Feeds usually list items from newer to older, so items with equal or without times
+// keep the reverse of the feed order, the latter placed before the rest.
+func chronological(items []*gofeed.Item) []*gofeed.Item {
+	sorted := make([]*gofeed.Item, len(items))
+	for i, item := range items {
+		sorted[len(items)-1-i] = item
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ti, tj := itemPublishedAt(sorted[i]), itemPublishedAt(sorted[j])
+		if ti == nil || tj == nil {
+			return ti == nil && tj != nil
+		}
+		return ti.Before(*tj)
 	})
-	if err != nil {
-		return err
+
+	return sorted
+}
+
+// latest returns the latest of times a and b.
+func latest(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
 	}
+	return a
+}
 
-	data, err := ioutil.ReadAll(resp.Body)
-	defer resp.Body.Close()
-	if err != nil {
-		return err
+// itemGUID returns the GUID of item, falling back to its link.
+func itemGUID(item *gofeed.Item) string {
+	if item.GUID != "" {
+		return item.GUID
 	}
+	return item.Link
+}
 
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("status code: %d, data: %s", resp.StatusCode, data)
+// itemHash returns the hex-encoded SHA-256 hash of the normalized title and link of item,
+// so items republished with new GUIDs or times are still recognized.
+// Returns empty string for items without title and link.
+func itemHash(item *gofeed.Item) string {
+	title := strings.ToLower(strings.Join(strings.Fields(item.Title), " "))
+	link := strings.TrimSpace(item.Link)
+	if title == "" && link == "" {
+		return ""
 	}
 
-	return nil
+	sum := sha256.Sum256([]byte(title + "\n" + link))
+	return hex.EncodeToString(sum[:])
+}
+
+// itemPublishedAt returns the published time of item, falling back to its updated time
+// for feeds that only populate the latter (e.g. some Atom feeds).
+func itemPublishedAt(item *gofeed.Item) *time.Time {
+	if item.PublishedParsed != nil {
+		return item.PublishedParsed
+	}
+	return item.UpdatedParsed
 }
@@ -0,0 +1,557 @@
+package rss2telegram
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// telegramRequest is a request to the bot api recorded by telegramServer.
+type telegramRequest struct {
+	Token  string
+	Method string
+	Params map[string]string
+}
+
+// telegramServer is a fake telegram bot api recording the requests sent to it.
+type telegramServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []telegramRequest
+	// fail returns the status code the request is failed with, zero to succeed.
+	fail func(r telegramRequest) int
+}
+
+// newTelegramServer returns started telegramServer closed at the end of the test.
+func newTelegramServer(t *testing.T) *telegramServer {
+	s := &telegramServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// the path is /bot{token}/{method}
+		path := strings.TrimPrefix(r.URL.Path, "/bot")
+		i := strings.LastIndexByte(path, '/')
+		req := telegramRequest{Token: path[:max(i, 0)], Method: path[i+1:], Params: map[string]string{}}
+		for k := range r.PostForm {
+			req.Params[k] = r.PostForm.Get(k)
+		}
+
+		s.mu.Lock()
+		fail := s.fail
+		if fail == nil || fail(req) == 0 {
+			s.requests = append(s.requests, req)
+		}
+		n := len(s.requests)
+		s.mu.Unlock()
+
+		if fail != nil {
+			if code := fail(req); code != 0 {
+				w.WriteHeader(code)
+				fmt.Fprintf(w, `{"ok":false,"error_code":%d,"description":"failed"}`, code)
+				return
+			}
+		}
+		fmt.Fprintf(w, `{"ok":true,"result":{"message_id":%d}}`, n)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// sent returns the requests sent successfully so far.
+func (s *telegramServer) sent() []telegramRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]telegramRequest(nil), s.requests...)
+}
+
+// newFeedServer returns started server responding with body of content type,
+// closed at the end of the test.
+func newFeedServer(t *testing.T, contentType, body string) *httptest.Server {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// testConfig returns Config posting feedURLs to chatID of bot api at apiURL, keeping the state
+// in a temporary file. Feeds are posted on the first run and the rate limits are off.
+func testConfig(t *testing.T, apiURL, chatID string, feedURLs ...string) Config {
+	return Config{
+		FeedURLs:           feedURLs,
+		BotAPIToken:        "token",
+		APIBaseURL:         apiURL,
+		ChatIDs:            []string{chatID},
+		IncludeLink:        true,
+		BackfillOnFirstRun: true,
+		Store:              newFileStore(filepath.Join(t.TempDir(), "state.json")),
+	}
+}
+
+// rssFeed returns RSS feed of items, each given as its title, link and published time.
+func rssFeed(items ...[3]string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0"?><rss version="2.0"><channel><title>Feed</title>`)
+	for _, it := range items {
+		fmt.Fprintf(&b, "<item><title>%s</title><link>%s</link><guid>%s</guid><pubDate>%s</pubDate><description>Body of %s</description></item>",
+			it[0], it[1], it[1], it[2], it[0])
+	}
+	b.WriteString(`</channel></rss>`)
+	return b.String()
+}
+
+// rfc1123 returns t formatted as RSS published time.
+func rfc1123(t time.Time) string {
+	return t.UTC().Format(time.RFC1123Z)
+}
+
+func TestCrossFeedDedup(t *testing.T) {
+	now := time.Now()
+	tg := newTelegramServer(t)
+	feedA := newFeedServer(t, "application/rss+xml", rssFeed(
+		[3]string{"Shared", "https://example.com/shared", rfc1123(now.Add(-2 * time.Hour))},
+		[3]string{"Only A", "https://example.com/a", rfc1123(now.Add(-time.Hour))},
+	))
+	feedB := newFeedServer(t, "application/rss+xml", rssFeed(
+		[3]string{"Shared again", "https://example.com/shared?utm_source=b", rfc1123(now.Add(-90 * time.Minute))},
+		[3]string{"Only B", "https://example.com/b", rfc1123(now.Add(-30 * time.Minute))},
+	))
+
+	for _, dedup := range []bool{false, true} {
+		t.Run(fmt.Sprint("dedup ", dedup), func(t *testing.T) {
+			before := len(tg.sent())
+			cfg := testConfig(t, tg.URL, "@chat", feedA.URL, feedB.URL)
+			cfg.CrossFeedDedup = dedup
+
+			sum, err := RunWithConfig(context.Background(), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := 4
+			if dedup {
+				want = 3
+			}
+			if got := len(tg.sent()) - before; got != want {
+				t.Errorf("sent %d messages, want %d", got, want)
+			}
+			if sum.ItemsSent != want {
+				t.Errorf("summary has %d items sent, want %d", sum.ItemsSent, want)
+			}
+
+			// the links are recorded per chat
+			links, err := cfg.Store.(LinkRecorder).ReadPostedLinks(context.Background(), "@chat")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dedup && len(links) != 3 {
+				t.Errorf("recorded links %v, want 3", links)
+			}
+		})
+	}
+}
+
+func TestRunWithConfigFeedFailures(t *testing.T) {
+	tg := newTelegramServer(t)
+	healthy := newFeedServer(t, "application/rss+xml", rssFeed(
+		[3]string{"One", "https://example.com/1", rfc1123(time.Now().Add(-time.Hour))},
+	))
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	tests := []struct {
+		name       string
+		feedURLs   []string
+		wantFailed int
+		wantSent   int
+		wantErr    bool
+	}{
+		{"one of feeds failed", []string{failing.URL, healthy.URL}, 1, 1, false},
+		{"all feeds failed", []string{failing.URL, failing.URL + "/other"}, 2, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, tg.URL, "1", tt.feedURLs...)
+
+			sum, err := RunWithConfig(context.Background(), cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RunWithConfig() error = %v, want error %v", err, tt.wantErr)
+			}
+			// the failed feeds do not stop the run, the rest of them are still posted
+			if sum.FeedsFailed != tt.wantFailed || sum.ItemsSent != tt.wantSent {
+				t.Errorf("FeedsFailed, ItemsSent = %d, %d, want %d, %d", sum.FeedsFailed, sum.ItemsSent, tt.wantFailed, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestHashDedup(t *testing.T) {
+	now := time.Now()
+	body := rssFeed(
+		[3]string{"One", "https://example.com/1", rfc1123(now.Add(-2 * time.Hour))},
+		[3]string{"Two", "https://example.com/2", rfc1123(now.Add(-time.Hour))},
+	)
+	var mu sync.Mutex
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, body)
+	}))
+	defer feed.Close()
+	tg := newTelegramServer(t)
+	cfg := testConfig(t, tg.URL, "1", feed.URL)
+	cfg.DedupMode = dedupModeHash
+	ctx := context.Background()
+
+	if _, err := RunWithConfig(ctx, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(tg.sent()); got != 2 {
+		t.Fatalf("first run sent %d messages, want 2", got)
+	}
+
+	// the unchanged item is republished with a new time, the other one is edited
+	mu.Lock()
+	body = rssFeed(
+		[3]string{"One", "https://example.com/1", rfc1123(now.Add(-time.Minute))},
+		[3]string{"Two edited", "https://example.com/2", rfc1123(now.Add(-time.Hour))},
+	)
+	mu.Unlock()
+	if _, err := RunWithConfig(ctx, cfg); err != nil {
+		t.Fatal(err)
+	}
+	sent := tg.sent()
+	if len(sent) != 3 || !strings.HasPrefix(sent[2].Params["text"], "*Two edited*") {
+		var got []string
+		for _, r := range sent {
+			got = append(got, strings.SplitN(r.Params["text"], "\n", 2)[0])
+		}
+		t.Errorf("sent %v, want the edited item posted again only", got)
+	}
+}
+
+func TestReadPostedLinksExpired(t *testing.T) {
+	store := newFileStore(filepath.Join(t.TempDir(), "state.json"))
+	ctx := context.Background()
+	links := map[string]time.Time{
+		"https://example.com/old": time.Now().Add(-2 * time.Hour),
+		"https://example.com/new": time.Now().Add(-time.Minute),
+	}
+	if err := store.WritePostedLinks(ctx, "1", links); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := readPostedLinks(ctx, store, "1", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.contains("https://example.com/old") || !p.contains("https://example.com/new") {
+		t.Errorf("posted links = %v, want the new one only", p.links)
+	}
+	if !p.changed {
+		t.Error("expired links are not dropped from the store")
+	}
+}
+
+func TestItemPublishedAt(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	feed, err := gofeed.NewParser().Parse(strings.NewReader(`<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Atom</title>
+  <updated>` + now.Format(time.RFC3339) + `</updated>
+  <entry>
+    <title>Published</title>
+    <link href="https://example.com/1"/>
+    <id>urn:1</id>
+    <published>` + now.Add(-3*time.Hour).Format(time.RFC3339) + `</published>
+    <updated>` + now.Add(-2*time.Hour).Format(time.RFC3339) + `</updated>
+  </entry>
+  <entry>
+    <title>Updated only</title>
+    <link href="https://example.com/2"/>
+    <id>urn:2</id>
+    <updated>` + now.Add(-time.Hour).Format(time.RFC3339) + `</updated>
+  </entry>
+  <entry>
+    <title>Undated</title>
+    <link href="https://example.com/3"/>
+    <id>urn:3</id>
+  </entry>
+</feed>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []time.Time{now.Add(-3 * time.Hour), now.Add(-time.Hour), {}}
+	for i, item := range feed.Items {
+		var got time.Time
+		if p := itemPublishedAt(item); p != nil {
+			got = *p
+		}
+		if !got.Equal(want[i]) {
+			t.Errorf("itemPublishedAt(%q) = %v, want %v", item.Title, got, want[i])
+		}
+	}
+}
+
+func TestChronological(t *testing.T) {
+	at := func(hours int) *time.Time {
+		t := time.Date(2020, 1, 1, hours, 0, 0, 0, time.UTC)
+		return &t
+	}
+	items := []*gofeed.Item{
+		{Title: "3", PublishedParsed: at(3)},
+		{Title: "1", PublishedParsed: at(1)},
+		{Title: "no time a"},
+		{Title: "4", PublishedParsed: at(4)},
+		{Title: "2b", PublishedParsed: at(2)},
+		{Title: "no time b"},
+		{Title: "2a", PublishedParsed: at(2)},
+	}
+	var got []string
+	for _, item := range chronological(items) {
+		got = append(got, item.Title)
+	}
+	want := "no time b,no time a,1,2a,2b,3,4"
+	if strings.Join(got, ",") != want {
+		t.Errorf("chronological() = %v, want %s", got, want)
+	}
+}
+
+func TestChronologicalShuffledFeed(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0"?><rss version="2.0"><channel><title>Feed</title>`)
+	for _, it := range []struct {
+		title string
+		age   time.Duration
+	}{{"Two", 3 * time.Hour}, {"Four", time.Hour}, {"One", 4 * time.Hour}, {"Three", 2 * time.Hour}} {
+		b.WriteString("<item><title>" + it.title + "</title><pubDate>" + now.Add(-it.age).Format(time.RFC1123Z) + "</pubDate></item>")
+	}
+	b.WriteString(`</channel></rss>`)
+	feed, err := gofeed.NewParser().Parse(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, item := range chronological(feed.Items) {
+		got = append(got, item.Title)
+	}
+	if want := "One,Two,Three,Four"; strings.Join(got, ",") != want {
+		t.Errorf("chronological() = %v, want %s", got, want)
+	}
+}
+
+func TestSendItemsStopOnError(t *testing.T) {
+	var sent []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		text := r.FormValue("text")
+		if strings.HasPrefix(text, "*Two*") {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request"}`))
+			return
+		}
+		sent = append(sent, text)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	bot := telegramBot{apiBaseURL: srv.URL, apiToken: "token", client: srv.Client(), maxAttempts: 1, message: testMessageOptions(t, parseModeMarkdown)}
+	items := []*gofeed.Item{{Title: "One"}, {Title: "Two"}, {Title: "Three"}}
+
+	errs := sendItems(context.Background(), bot, "1", items, feedOptions{concurrency: 1}, true)
+	if errs[0] != nil || errs[1] == nil || errs[2] != errNotSent {
+		t.Errorf("sendItems() = %v, want [<nil> <error> %v]", errs, errNotSent)
+	}
+	if len(sent) != 1 || !strings.HasPrefix(sent[0], "*One*") {
+		t.Errorf("sent %q, want only the item before the failed one", sent)
+	}
+}
+
+func TestSendConcurrencyByTime(t *testing.T) {
+	now := time.Now()
+	feed := newFeedServer(t, "application/rss+xml", rssFeed(
+		[3]string{"Three", "https://example.com/3", rfc1123(now.Add(-time.Hour))},
+		[3]string{"Two", "https://example.com/2", rfc1123(now.Add(-2 * time.Hour))},
+		[3]string{"One", "https://example.com/1", rfc1123(now.Add(-3 * time.Hour))},
+	))
+	var mu sync.Mutex
+	var sent []string
+	failing := true
+	third := make(chan struct{})
+	var thirdOnce sync.Once
+	tg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		title := strings.SplitN(r.FormValue("text"), "\n", 2)[0]
+		mu.Lock()
+		fail := failing && title == "*Two*"
+		mu.Unlock()
+		if title == "*Three*" {
+			thirdOnce.Do(func() { close(third) })
+		}
+		if fail {
+			// the item fails only after the next one is sent concurrently
+			select {
+			case <-third:
+			case <-time.After(5 * time.Second):
+				t.Error("the item after the failed one was not sent concurrently")
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request"}`))
+			return
+		}
+		mu.Lock()
+		sent = append(sent, title)
+		mu.Unlock()
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+	}))
+	defer tg.Close()
+	cfg := testConfig(t, tg.URL, "1", feed.URL)
+	cfg.SendConcurrency = 2
+	ctx := context.Background()
+
+	if _, err := RunWithConfig(ctx, cfg); err != nil {
+		t.Fatal(err)
+	}
+	publishedAt, err := cfg.Store.ReadPublishedAt(ctx, "1", feed.URL)
+	if want := now.Add(-3 * time.Hour).Truncate(time.Second); err != nil || !publishedAt.Equal(want) {
+		t.Errorf("ReadPublishedAt() = %v, %v, want the cursor at the item before the failed one %v", publishedAt, err, want)
+	}
+	mu.Lock()
+	if want := "*One*,*Three*"; strings.Join(sent, ",") != want {
+		t.Errorf("sent %v, want %s", sent, want)
+	}
+	sent, failing = nil, false
+	mu.Unlock()
+
+	// the failed item and the items after it are sent on the next run
+	if _, err := RunWithConfig(ctx, cfg); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// the items are sent concurrently, so they may arrive in any order
+	sort.Strings(sent)
+	if want := "*Three*,*Two*"; strings.Join(sent, ",") != want {
+		t.Errorf("sent %v, want %s", sent, want)
+	}
+	publishedAt, err = cfg.Store.ReadPublishedAt(ctx, "1", feed.URL)
+	if want := now.Add(-time.Hour).Truncate(time.Second); err != nil || !publishedAt.Equal(want) {
+		t.Errorf("ReadPublishedAt() = %v, %v, want the cursor at the latest item %v", publishedAt, err, want)
+	}
+}
+
+func TestHTTPHandler(t *testing.T) {
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprintf(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>Feed</title>`+
+			`<item><title>One</title><link>https://example.com/1</link><pubDate>%s</pubDate></item></channel></rss>`,
+			time.Now().Add(-time.Hour).Format(time.RFC1123Z))
+	}))
+	defer feed.Close()
+	var sent int
+	tg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent++
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer tg.Close()
+	env := map[string]string{
+		"RSS_FEED_URL":           feed.URL,
+		"TELEGRAM_BOT_API_TOKEN": "token",
+		"TELEGRAM_CHAT_ID":       "1",
+		"TELEGRAM_API_BASE_URL":  tg.URL,
+		"BACKFILL_ON_FIRST_RUN":  "true",
+		"STORE_BACKEND":          "file",
+		"STORE_FILE_PATH":        filepath.Join(t.TempDir(), "state.json"),
+	}
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+
+	for _, path := range []string{"/favicon.ico", "/robots.txt", "/run/"} {
+		w := httptest.NewRecorder()
+		HTTPHandler(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s responded with %d, want 404", path, w.Code)
+		}
+	}
+	if sent != 0 {
+		t.Fatalf("requests to other paths sent %d messages, want none", sent)
+	}
+
+	w := httptest.NewRecorder()
+	HTTPHandler(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("/ responded with %d: %s", w.Code, w.Body)
+	}
+	var sum Summary
+	if err := json.Unmarshal(w.Body.Bytes(), &sum); err != nil {
+		t.Fatal(err)
+	}
+	if sum.ItemsSent != 1 || sent != 1 {
+		t.Errorf("summary %+v and %d messages sent, want 1 item sent", sum, sent)
+	}
+}
+
+func TestTooOld(t *testing.T) {
+	cutoff := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	at := func(d time.Duration) *time.Time {
+		t := cutoff.Add(d)
+		return &t
+	}
+	tests := []struct {
+		item *gofeed.Item
+		want bool
+	}{
+		{&gofeed.Item{Title: "After", PublishedParsed: at(2 * time.Hour)}, false},
+		{&gofeed.Item{Title: "Just after", PublishedParsed: at(time.Second)}, false},
+		{&gofeed.Item{Title: "Just before", PublishedParsed: at(-time.Second)}, true},
+		{&gofeed.Item{Title: "Updated before", UpdatedParsed: at(-48 * time.Hour)}, true},
+		{&gofeed.Item{Title: "Undated"}, false},
+	}
+	opts := feedOptions{minItemDate: cutoff}
+	for _, tt := range tests {
+		if got := opts.tooOld(tt.item); got != tt.want {
+			t.Errorf("tooOld(%q) = %v, want %v", tt.item.Title, got, tt.want)
+		}
+		if (feedOptions{}).tooOld(tt.item) {
+			t.Errorf("tooOld(%q) without the cutoff = true, want false", tt.item.Title)
+		}
+	}
+}
+
+func TestMinItemDateEnv(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+		err   bool
+	}{
+		{"2024-03-02T10:00:00Z", time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC), false},
+		{"2024-03-02", time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC), false},
+		{"", time.Time{}, false},
+		{"yesterday", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Setenv("MIN_ITEM_DATE", tt.value)
+		got, err := envTime("MIN_ITEM_DATE")
+		if (err != nil) != tt.err || !got.Equal(tt.want) {
+			t.Errorf("envTime() of %q = %v, %v, want %v", tt.value, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package rss2telegram
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+	md "github.com/Skarlso/html-to-markdown"
+	"github.com/Skarlso/html-to-markdown/escape"
+	"golang.org/x/net/html"
+)
+
+var (
+	// textBrackets replaces the brackets of text with placeholders escaped by textRule.
+	textBrackets = strings.NewReplacer("[", "\uE000", "]", "\uE001")
+	// escapedBrackets replaces the placeholders of textBrackets with escaped opening brackets,
+	// telegram markdown links can't start at the closing ones, so they are kept as is.
+	escapedBrackets = strings.NewReplacer("\uE000", `\[`, "\uE001", "]")
+	// markdownEscapes matches backslash-escaped characters of markdown.
+	markdownEscapes = regexp.MustCompile(`\\.`)
+)
+
+// textRule replaces the text rule of html-to-markdown converters, which escapes brackets of text
+// as "$&" instead of the brackets and keeps the whitespace of the HTML source, which telegram
+// renders as is. Whitespace of text is collapsed to single spaces and trimmed at the start of lines.
+var textRule = md.Rule{
+	Filter: []string{"#text"},
+	Replacement: func(content string, selec *goquery.Selection, opt *md.Options) *string {
+		n := selec.Get(0)
+		text := selec.Text()
+		if strings.TrimSpace(text) == "" {
+			// the whitespace between inline elements separates their words, e.g. "<b>a</b> <i>b</i>"
+			if wordNode(n.PrevSibling) && wordNode(n.NextSibling) {
+				return md.String(" ")
+			}
+			return md.String("")
+		}
+		// line breaks of HTML text are spaces, like in browsers, so lines break at <br> and blocks only
+		text = spaces.ReplaceAllString(text, " ")
+		if lineStart(n) {
+			text = strings.TrimLeft(text, " ")
+		}
+		text = escapedBrackets.Replace(escape.Markdown(textBrackets.Replace(text)))
+		return &text
+	},
+}
+
+// wordNode reports whether HTML node n is text or an inline element other than a line break,
+// so the text next to it continues its line.
+func wordNode(n *html.Node) bool {
+	return n != nil && (n.Type == html.TextNode || n.Type == html.ElementNode && md.IsInlineElement(n.Data) && n.Data != "br")
+}
+
+// lineStart reports whether HTML node n starts a line, i.e. follows a line break or a block element
+// or is the first node of a block element.
+func lineStart(n *html.Node) bool {
+	if n.PrevSibling == nil {
+		return n.Parent == nil || !wordNode(n.Parent) || lineStart(n.Parent)
+	}
+	return !wordNode(n.PrevSibling)
+}
+
+// brRule breaks lines at <br>, which html-to-markdown converters drop.
+var brRule = md.Rule{
+	Filter: []string{"br"},
+	Replacement: func(content string, selec *goquery.Selection, opt *md.Options) *string {
+		return md.String("\n")
+	},
+}
+
+// strongRule returns the rule replacing the bold rule of html-to-markdown converters, which drops
+// the spaces around the bold text, e.g. of "a<b> b </b>c", delimiting bold by delimiter.
+// Telegram markdown does not support escaped characters inside of entities, so bold delimited
+// by single asterisks is closed before them and reopened after, e.g. `*2*\**2=4*` of "2*2=4".
+func strongRule(delimiter string) md.Rule {
+	return md.Rule{
+		Filter: []string{"strong", "b"},
+		Replacement: func(content string, selec *goquery.Selection, opt *md.Options) *string {
+			trimmed := strings.TrimSpace(content)
+			if trimmed == "" {
+				return md.String("")
+			}
+			text := delimiter + trimmed + delimiter
+			if delimiter == "*" {
+				text = boldAroundEscapes(trimmed)
+			}
+			if strings.TrimLeftFunc(content, unicode.IsSpace) != content {
+				text = " " + text
+			}
+			if strings.TrimRightFunc(content, unicode.IsSpace) != content {
+				text += " "
+			}
+			return &text
+		},
+	}
+}
+
+// boldAroundEscapes returns markdown s delimited as bold by single asterisks, leaving
+// the escaped characters of s out of the bold entities.
+func boldAroundEscapes(s string) string {
+	var b strings.Builder
+	var last int
+	for _, loc := range markdownEscapes.FindAllStringIndex(s, -1) {
+		if last < loc[0] {
+			b.WriteString("*" + s[last:loc[0]] + "*")
+		}
+		b.WriteString(s[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	if last < len(s) {
+		b.WriteString("*" + s[last:] + "*")
+	}
+	return b.String()
+}
@@ -0,0 +1,192 @@
+package rss2telegram
+
+import (
+	"bytes"
+	"html"
+	"net/url"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// telegramTags are the HTML tags supported by telegram, other tags are stripped.
+var telegramTags = map[atom.Atom]bool{
+	atom.B: true, atom.Strong: true,
+	atom.I: true, atom.Em: true,
+	atom.U: true, atom.Ins: true,
+	atom.S: true, atom.Strike: true, atom.Del: true,
+	atom.A:          true,
+	atom.Code:       true,
+	atom.Pre:        true,
+	atom.Blockquote: true,
+	atom.Span:       true,
+}
+
+// linkSchemes are the schemes of links kept in a tags.
+var linkSchemes = map[string]bool{"http": true, "https": true, "tg": true, "mailto": true}
+
+// openTag is an element open in sanitized HTML.
+type openTag struct {
+	name string
+	// kept is set if the tag is written to the output.
+	kept bool
+}
+
+// sanitizeHTML converts HTML s to telegram HTML: tags supported by telegram are kept without
+// attributes except for the href of links and the spoiler class of spans, other tags are stripped,
+// block elements are separated by line breaks and the text is escaped.
+// Links are stripped of trackingParams unless it is nil.
+func sanitizeHTML(s string, trackingParams []string) string {
+	var b bytes.Buffer
+	var stack []openTag
+	var skip, pre int
+	z := xhtml.NewTokenizer(strings.NewReader(s))
+	for {
+		tt := z.Next()
+		switch tt {
+		case xhtml.ErrorToken:
+			for i := len(stack) - 1; 0 <= i; i-- {
+				if stack[i].kept {
+					endTag(&b, stack[i].name)
+				}
+			}
+			return strings.TrimSpace(b.String())
+		case xhtml.TextToken:
+			if skip > 0 {
+				continue
+			}
+			text := string(z.Text())
+			if pre == 0 {
+				text = spaces.ReplaceAllString(text, " ")
+				if b.Len() == 0 || bytes.HasSuffix(b.Bytes(), []byte("\n")) || bytes.HasSuffix(b.Bytes(), []byte(" ")) {
+					text = strings.TrimLeft(text, " ")
+				}
+			}
+			b.WriteString(html.EscapeString(text))
+		case xhtml.StartTagToken, xhtml.EndTagToken, xhtml.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			a := atom.Lookup(name)
+			switch a {
+			case atom.Script, atom.Style:
+				// skip the content of non-text elements
+				if tt == xhtml.StartTagToken {
+					skip++
+				} else if tt == xhtml.EndTagToken && skip > 0 {
+					skip--
+				}
+				continue
+			case atom.Br, atom.Li, atom.Tr:
+				if tt != xhtml.EndTagToken {
+					lineBreaks(&b, 1)
+				}
+			case atom.P, atom.Div, atom.Ul, atom.Ol, atom.Table,
+				atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Hr:
+				lineBreaks(&b, 2)
+			}
+			if !telegramTags[a] || tt == xhtml.SelfClosingTagToken {
+				continue
+			}
+
+			if tt == xhtml.EndTagToken {
+				// close the elements up to the matching open one
+				for i := len(stack) - 1; 0 <= i; i-- {
+					if stack[i].name != string(name) {
+						continue
+					}
+					for j := len(stack) - 1; i <= j; j-- {
+						if stack[j].kept {
+							endTag(&b, stack[j].name)
+						}
+						if stack[j].name == "pre" && pre > 0 {
+							pre--
+						}
+					}
+					stack = stack[:i]
+					if a == atom.Pre || a == atom.Blockquote {
+						lineBreaks(&b, 2)
+					}
+					break
+				}
+				continue
+			}
+
+			attrs := map[string]string{}
+			for hasAttr {
+				var k, v []byte
+				k, v, hasAttr = z.TagAttr()
+				attrs[string(k)] = string(v)
+			}
+
+			tag := "<" + string(name) + ">"
+			switch a {
+			case atom.A:
+				u, err := url.Parse(attrs["href"])
+				if err != nil || !linkSchemes[strings.ToLower(u.Scheme)] {
+					tag = ""
+					break
+				}
+				href := attrs["href"]
+				if trackingParams != nil {
+					href = stripTrackingParams(href, trackingParams)
+				}
+				tag = `<a href="` + html.EscapeString(href) + `">`
+			case atom.Span:
+				if attrs["class"] != "tg-spoiler" {
+					tag = ""
+					break
+				}
+				tag = `<span class="tg-spoiler">`
+			case atom.Code:
+				if lang := attrs["class"]; strings.HasPrefix(lang, "language-") && !strings.ContainsAny(lang, ` "`) {
+					tag = `<code class="` + lang + `">`
+				}
+			case atom.Pre, atom.Blockquote:
+				lineBreaks(&b, 2)
+				if a == atom.Blockquote && inBlockquote(stack) {
+					// telegram does not support nested blockquotes, so only the outermost one is kept
+					tag = ""
+				}
+			}
+			if a == atom.Pre {
+				pre++
+			}
+
+			b.WriteString(tag)
+			stack = append(stack, openTag{name: string(name), kept: tag != ""})
+		}
+	}
+}
+
+// inBlockquote reports whether a blockquote is open in stack.
+func inBlockquote(stack []openTag) bool {
+	for _, t := range stack {
+		if t.name == "blockquote" && t.kept {
+			return true
+		}
+	}
+	return false
+}
+
+// endTag writes the end tag of element name to b. The line breaks at the end of blockquotes
+// are trimmed, so the quote does not end with blank lines.
+func endTag(b *bytes.Buffer, name string) {
+	if name == "blockquote" {
+		b.Truncate(len(bytes.TrimRight(b.Bytes(), " \n")))
+	}
+	b.WriteString("</" + name + ">")
+}
+
+// lineBreaks ends the text in b with at least n line breaks, trimming the trailing spaces.
+// Nothing is written at the start of the text or of a blockquote.
+func lineBreaks(b *bytes.Buffer, n int) {
+	trimmed := bytes.TrimRight(b.Bytes(), " ")
+	b.Truncate(len(trimmed))
+	if b.Len() == 0 || bytes.HasSuffix(trimmed, []byte("<blockquote>")) {
+		return
+	}
+	for i := len(trimmed) - 1; 0 <= i && trimmed[i] == '\n' && n > 0; i-- {
+		n--
+	}
+	b.WriteString(strings.Repeat("\n", n))
+}
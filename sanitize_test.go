@@ -0,0 +1,44 @@
+package rss2telegram
+
+import "testing"
+
+func TestSanitizeHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"nested", `<b>bold <i>both <u>all</u></i></b>`, `<b>bold <i>both <u>all</u></i></b>`},
+		{"misnested", `<b><i>x</b> y</i>`, `<b><i>x</i></b> y`},
+		{"unclosed", `<b>bold <i>italic`, `<b>bold <i>italic</i></b>`},
+		{"unsupported", `<font color="red">red</font> <img src="a.png"> <mark>marked</mark>`, `red marked`},
+		{"unsupported around supported", `<section><em>a <big>b</big></em></section>`, `<em>a b</em>`},
+		{"attributes", `<b class="x" onclick="alert(1)">x</b>`, `<b>x</b>`},
+		{"link", `<a href="https://example.com/?a=1&amp;b=2" title="t">link</a>`, `<a href="https://example.com/?a=1&amp;b=2">link</a>`},
+		{"script link", `<a href="javascript:alert(1)">link</a>`, `link`},
+		{"spoiler", `<span class="tg-spoiler">hidden</span> <span class="big">shown</span>`, `<span class="tg-spoiler">hidden</span> shown`},
+		{"script", `a<script>alert("<b>")</script><style>b{}</style> b`, `a b`},
+		{"escape", `a < b & c > d`, `a &lt; b &amp; c &gt; d`},
+		{"entities", `&lt;b&gt; &amp;amp;`, `&lt;b&gt; &amp;amp;`},
+		{"paragraphs", `<p>one<br>two</p><ul><li>three</li><li>four</li></ul>`, "one\ntwo\n\nthree\nfour"},
+		{"code", `<pre><code class="language-go">if a &lt; b {
+	return
+}</code></pre>`, "<pre><code class=\"language-go\">if a &lt; b {\n\treturn\n}</code></pre>"},
+		{"nested blockquotes", `<blockquote>a<blockquote>b</blockquote>c</blockquote>`, "<blockquote>a\n\nb\n\nc</blockquote>"},
+		{"blockquote paragraphs", `<blockquote><p>a</p><blockquote><p>b</p></blockquote><p>c</p></blockquote>d`, "<blockquote>a\n\nb\n\nc</blockquote>\n\nd"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeHTML(tt.in, nil); got != tt.want {
+				t.Errorf("sanitizeHTML(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeHTMLTrackingParams(t *testing.T) {
+	got := sanitizeHTML(`<a href="https://example.com/?id=1&amp;utm_source=feed">link</a>`, defaultTrackingParams)
+	if want := `<a href="https://example.com/?id=1">link</a>`; got != want {
+		t.Errorf("sanitizeHTML() = %q, want %q", got, want)
+	}
+}
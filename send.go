@@ -0,0 +1,49 @@
+package rss2telegram
+
+import "context"
+
+// SendMessage posts text formatted according to cfg.ParseMode to telegram chat chatID
+// with the bot of cfg, split into several messages if it exceeds telegram message length limit.
+// Only the settings of the bot and the http client of cfg are used, the feeds may be unset.
+func SendMessage(ctx context.Context, cfg Config, chatID, text string) error {
+	bot, _, err := cfg.botSettings()
+	if err != nil {
+		return err
+	}
+	for _, chunk := range splitMessage(text, maxMessageLength, bot.message.parseMode) {
+		if err := sendMessage(ctx, bot, chatID, chunk, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SendPhoto posts photo url with caption formatted according to cfg.ParseMode to telegram chat chatID
+// with the bot of cfg, the caption is truncated to telegram caption length limit.
+func SendPhoto(ctx context.Context, cfg Config, chatID, photo, caption string) error {
+	bot, _, err := cfg.botSettings()
+	if err != nil {
+		return err
+	}
+	return sendPhoto(ctx, bot, chatID, photo, truncateMessage(caption, maxCaptionLength, bot.message.parseMode), "")
+}
+
+// SendAudio posts audio url with title and caption formatted according to cfg.ParseMode to telegram
+// chat chatID with the bot of cfg, the caption is truncated to telegram caption length limit.
+func SendAudio(ctx context.Context, cfg Config, chatID, audio, title, caption string) error {
+	bot, _, err := cfg.botSettings()
+	if err != nil {
+		return err
+	}
+	return sendAudio(ctx, bot, chatID, audio, title, truncateMessage(caption, maxCaptionLength, bot.message.parseMode), "")
+}
+
+// SendVideo posts video url with caption formatted according to cfg.ParseMode to telegram chat chatID
+// with the bot of cfg, the caption is truncated to telegram caption length limit.
+func SendVideo(ctx context.Context, cfg Config, chatID, video, caption string) error {
+	bot, _, err := cfg.botSettings()
+	if err != nil {
+		return err
+	}
+	return sendVideo(ctx, bot, chatID, video, truncateMessage(caption, maxCaptionLength, bot.message.parseMode), "")
+}
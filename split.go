@@ -0,0 +1,207 @@
+package rss2telegram
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// splitMessage splits text formatted according to parseMode into chunks of at most limit characters.
+// Text is split on paragraph, line or word boundaries where possible and never
+// inside of a formatting entity unless the entity itself exceeds the limit.
+func splitMessage(text string, limit int, parseMode string) []string {
+	var chunks []string
+	for utf8.RuneCountInString(text) > limit {
+		cut := splitPoint(text, limit, newEntityScanner(parseMode))
+		if chunk := strings.TrimRight(text[:cut], " \n"); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		text = strings.TrimLeft(text[cut:], " \n")
+	}
+	if text != "" {
+		chunks = append(chunks, text)
+	}
+	return chunks
+}
+
+// truncateMessage returns the first chunk of text formatted according to parseMode
+// that is at most limit characters long.
+func truncateMessage(text string, limit int, parseMode string) string {
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	return strings.TrimRight(text[:splitPoint(text, limit, newEntityScanner(parseMode))], " \n")
+}
+
+// splitPoint returns the byte offset in text to split it at so the first part
+// is at most limit characters long.
+func splitPoint(text string, limit int, s entityScanner) int {
+	// max is the byte offset right after the limit-th character
+	max := len(text)
+	for n := range text {
+		if limit == 0 {
+			max = n
+			break
+		}
+		limit--
+	}
+
+	// last safe (outside of an entity) offsets of each boundary kind
+	var paragraph, line, word, any int
+	i := 0
+	for i < max {
+		if s.outside() && utf8.RuneStart(text[i]) {
+			switch {
+			case strings.HasPrefix(text[i:], "\n\n"):
+				paragraph = i
+			case text[i] == '\n':
+				line = i
+			case text[i] == ' ':
+				word = i
+			}
+			any = i
+		}
+		i += s.scan(text[i:])
+	}
+	if i == max && s.outside() {
+		any = max
+	}
+
+	// prefer the kind of boundary that keeps at least half of the limit in the chunk
+	for _, cut := range []int{paragraph, line, word} {
+		if cut > max/2 {
+			return cut
+		}
+	}
+	// otherwise take the latest boundary of any kind
+	for _, cut := range []int{maxInt(paragraph, line, word), any} {
+		if cut > 0 {
+			return cut
+		}
+	}
+
+	// the entity at the start of the text is too long, cut it at the limit
+	return max
+}
+
+// entityScanner tracks whether a position in formatted text is inside of an entity.
+type entityScanner interface {
+	// scan consumes the beginning of text and returns the number of bytes consumed.
+	scan(text string) int
+	// outside reports whether the scanned text ends outside of any entity.
+	outside() bool
+}
+
+// newEntityScanner returns entityScanner for text formatted according to parseMode.
+func newEntityScanner(parseMode string) entityScanner {
+	switch parseMode {
+	case parseModeHTML:
+		return &htmlScanner{}
+	case parseModeMarkdownV2:
+		return &markdownScanner{v2: true}
+	case parseModeNone:
+		return plainScanner{}
+	default:
+		return &markdownScanner{}
+	}
+}
+
+// plainScanner is entityScanner of plain text, which has no entities.
+type plainScanner struct{}
+
+func (plainScanner) scan(text string) int { return 1 }
+
+func (plainScanner) outside() bool { return true }
+
+// markdownScanner is entityScanner of telegram markdown and MarkdownV2.
+type markdownScanner struct {
+	v2 bool
+	// closer is the delimiter closing the current entity, empty outside of entities.
+	closer string
+}
+
+// markdownDelimiters are the delimiters opening telegram markdown entities, longest first.
+var markdownDelimiters = []string{"```", "`", "*", "_", "["}
+
+// markdownV2Delimiters are the delimiters opening telegram MarkdownV2 entities, longest first.
+var markdownV2Delimiters = []string{"```", "||", "__", "`", "*", "_", "~", "["}
+
+func (m *markdownScanner) scan(text string) int {
+	if text[0] == '\\' && len(text) > 1 && text[1] < utf8.RuneSelf && (m.closer == "" || m.v2) {
+		// escaped character, escaping inside of entities is supported in MarkdownV2 only
+		return 2
+	}
+
+	if m.closer == "" {
+		delimiters := markdownDelimiters
+		if m.v2 {
+			delimiters = markdownV2Delimiters
+		}
+		for _, d := range delimiters {
+			if strings.HasPrefix(text, d) {
+				m.closer = d
+				if d == "[" {
+					m.closer = "]"
+				}
+				return len(d)
+			}
+		}
+		return 1
+	}
+
+	switch {
+	case m.closer == "]" && strings.HasPrefix(text, "]("):
+		// link text is followed by link url
+		m.closer = ")"
+		return 2
+	case strings.HasPrefix(text, m.closer):
+		n := len(m.closer)
+		m.closer = ""
+		return n
+	}
+	return 1
+}
+
+func (m *markdownScanner) outside() bool {
+	return m.closer == ""
+}
+
+// htmlScanner is entityScanner of telegram HTML.
+type htmlScanner struct {
+	// inTag is set inside of a tag, inRef is set inside of a character reference.
+	inTag, inRef bool
+	// depth is the number of open elements.
+	depth int
+}
+
+func (h *htmlScanner) scan(text string) int {
+	switch {
+	case h.inTag:
+		h.inTag = text[0] != '>'
+	case strings.HasPrefix(text, "</"):
+		h.inTag = true
+		h.depth--
+	case text[0] == '<':
+		h.inTag = true
+		h.depth++
+	case text[0] == '&':
+		h.inRef = true
+	case text[0] == ';':
+		h.inRef = false
+	}
+	return 1
+}
+
+func (h *htmlScanner) outside() bool {
+	return !h.inTag && !h.inRef && h.depth <= 0
+}
+
+// maxInt returns the largest of values.
+func maxInt(values ...int) int {
+	var m int
+	for _, v := range values {
+		if v > m {
+			m = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,135 @@
+package rss2telegram
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitMessageLong(t *testing.T) {
+	// 100 paragraphs of 98 characters separated by blank lines make a 10,000 characters body
+	paragraph := strings.Repeat("word ", 18) + "*bold*.."
+	var text strings.Builder
+	text.WriteString("*Long*")
+	for i := 0; i < 100; i++ {
+		text.WriteString("\n\n" + paragraph)
+	}
+
+	chunks := splitMessage(text.String(), maxMessageLength, parseModeMarkdown)
+	if len(chunks) != 3 {
+		t.Fatalf("split into %d messages, want 3", len(chunks))
+	}
+	var paragraphs int
+	for i, chunk := range chunks {
+		if n := utf8.RuneCountInString(chunk); n > maxMessageLength {
+			t.Errorf("message %d has %d characters, want at most %d", i, n, maxMessageLength)
+		}
+		paragraphs += strings.Count(chunk, "*bold*")
+		if strings.Count(chunk, "*")%2 != 0 {
+			t.Errorf("message %d is cut inside of an entity", i)
+		}
+	}
+	if !strings.HasPrefix(chunks[0], "*Long*\n\n") {
+		t.Errorf("first message = %.40q, want the title first", chunks[0])
+	}
+	if paragraphs != 100 {
+		t.Errorf("messages have %d paragraphs, want 100 in order", paragraphs)
+	}
+}
+
+func TestSplitMessageEntities(t *testing.T) {
+	tests := []struct {
+		name      string
+		parseMode string
+		text      string
+		limit     int
+		want      []string
+	}{
+		{
+			name:      "markdown bold",
+			parseMode: parseModeMarkdown,
+			text:      "hello world *bold words go here*",
+			limit:     20,
+			want:      []string{"hello world", "*bold words go here*"},
+		},
+		{
+			name:      "markdown link",
+			parseMode: parseModeMarkdown,
+			text:      "see [the link](https://x.io) now",
+			limit:     25,
+			want:      []string{"see", "[the link](https://x.io)", "now"},
+		},
+		{
+			name:      "markdown code block",
+			parseMode: parseModeMarkdown,
+			text:      "intro\n```\na b c\n```",
+			limit:     15,
+			want:      []string{"intro", "```\na b c\n```"},
+		},
+		{
+			name:      "markdownV2 spoiler",
+			parseMode: parseModeMarkdownV2,
+			text:      "hello world ||spoiler text|| end",
+			limit:     20,
+			want:      []string{"hello world", "||spoiler text|| end"},
+		},
+		{
+			name:      "markdownV2 escaped delimiter",
+			parseMode: parseModeMarkdownV2,
+			text:      "a\\* b c d e f g h",
+			limit:     10,
+			want:      []string{"a\\* b c d", "e f g h"},
+		},
+		{
+			name:      "HTML bold",
+			parseMode: parseModeHTML,
+			text:      "hello world <b>bold text</b>",
+			limit:     20,
+			want:      []string{"hello world", "<b>bold text</b>"},
+		},
+		{
+			name:      "HTML link",
+			parseMode: parseModeHTML,
+			text:      `one <a href="https://x.io">two three</a> end`,
+			limit:     40,
+			want:      []string{"one", `<a href="https://x.io">two three</a> end`},
+		},
+		{
+			name:      "entity over the limit",
+			parseMode: parseModeMarkdown,
+			text:      "*" + strings.Repeat("b", 30) + "*",
+			limit:     10,
+			want:      []string{"*bbbbbbbbb", "bbbbbbbbbb", "bbbbbbbbbb", "b*"},
+		},
+		{
+			name:      "paragraphs",
+			parseMode: parseModeMarkdown,
+			text:      "first line\nsecond\n\nthird paragraph",
+			limit:     20,
+			want:      []string{"first line\nsecond", "third paragraph"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitMessage(tt.text, tt.limit, tt.parseMode)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitMessage() = %q, want %q", got, tt.want)
+			}
+			for i, chunk := range got {
+				if n := utf8.RuneCountInString(chunk); n > tt.limit {
+					t.Errorf("chunk %d has %d characters, want at most %d", i, n, tt.limit)
+				}
+			}
+		})
+	}
+}
+
+func TestTruncateMessage(t *testing.T) {
+	if got, want := truncateMessage("short", 10, parseModeHTML), "short"; got != want {
+		t.Errorf("truncateMessage() = %q, want %q", got, want)
+	}
+	if got, want := truncateMessage("caption <b>bold words</b>", 20, parseModeHTML), "caption"; got != want {
+		t.Errorf("truncateMessage() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,335 @@
+package rss2telegram
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Store backends selectable with STORE_BACKEND.
+const (
+	storeBackendFirestore = "firestore"
+	storeBackendFile      = "file"
+	storeBackendRedis     = "redis"
+)
+
+// defaultStoreFilePath is the default path of the state file of the file store backend.
+const defaultStoreFilePath = "rss2telegram.json"
+
+// Store is the storage of the state of feeds posted to each telegram chat.
+// Reads of never written state return zero values.
+type Store interface {
+	// ReadPublishedAt returns the published time of the latest item of feedURL posted to chatID.
+	ReadPublishedAt(ctx context.Context, chatID, feedURL string) (time.Time, error)
+	// WritePublishedAt stores the published time of the latest item of feedURL posted to chatID.
+	WritePublishedAt(ctx context.Context, chatID, feedURL string, t time.Time) error
+	// ReadSeenKeys returns the GUIDs or hashes, depending on dedup mode, of items of feedURL
+	// posted to chatID.
+	ReadSeenKeys(ctx context.Context, chatID, feedURL, mode string) ([]string, error)
+	// WriteSeenKeys stores the GUIDs or hashes, depending on dedup mode, of items of feedURL
+	// posted to chatID.
+	WriteSeenKeys(ctx context.Context, chatID, feedURL, mode string, keys []string) error
+	// ReadFeedCache returns the validators of the last response of feedURL fetched for chatID.
+	ReadFeedCache(ctx context.Context, chatID, feedURL string) (FeedCache, error)
+	// WriteFeedCache stores the validators of the last response of feedURL fetched for chatID.
+	WriteFeedCache(ctx context.Context, chatID, feedURL string, cache FeedCache) error
+	// ReadRevisions returns the last posted revisions of items of feedURL posted to chatID by GUID.
+	ReadRevisions(ctx context.Context, chatID, feedURL string) (map[string]ItemRevision, error)
+	// WriteRevisions stores the last posted revisions of items of feedURL posted to chatID by GUID.
+	WriteRevisions(ctx context.Context, chatID, feedURL string, revisions map[string]ItemRevision) error
+}
+
+// fileStore is Store keeping the state of all telegram chats in a JSON file.
+type fileStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// fileChat is the state of a telegram chat in the file of fileStore, keyed by feed url.
+type fileChat struct {
+	PublishedAt map[string]time.Time               `json:"publishedAt,omitempty"`
+	SeenGUIDs   map[string][]string                `json:"seenGUIDs,omitempty"`
+	SeenHashes  map[string][]string                `json:"seenHashes,omitempty"`
+	HTTPCache   map[string]FeedCache               `json:"httpCache,omitempty"`
+	Revisions   map[string]map[string]ItemRevision `json:"revisions,omitempty"`
+	LastRunAt   map[string]time.Time               `json:"lastRunAt,omitempty"`
+	// PostedLinks are the times links were posted to the chat by any feed, keyed by link.
+	PostedLinks map[string]time.Time `json:"postedLinks,omitempty"`
+}
+
+// seen returns the seen keys of dedup mode, creating the map if needed.
+func (c *fileChat) seen(mode string) map[string][]string {
+	if mode == dedupModeHash {
+		if c.SeenHashes == nil {
+			c.SeenHashes = map[string][]string{}
+		}
+		return c.SeenHashes
+	}
+	if c.SeenGUIDs == nil {
+		c.SeenGUIDs = map[string][]string{}
+	}
+	return c.SeenGUIDs
+}
+
+// newFileStore returns fileStore keeping the state in the file at path.
+// The file is created on the first write.
+func newFileStore(path string) *fileStore {
+	return &fileStore{path: path}
+}
+
+// ReadPublishedAt reads the time feedURL feed was published to telegram chat chatID from the file.
+func (s *fileStore) ReadPublishedAt(ctx context.Context, chatID, feedURL string) (time.Time, error) {
+	var t time.Time
+	err := s.read(chatID, func(c *fileChat) {
+		t = c.PublishedAt[feedURL]
+	})
+	return t, err
+}
+
+// WritePublishedAt writes the time feedURL feed was published to telegram chat chatID to the file.
+func (s *fileStore) WritePublishedAt(ctx context.Context, chatID, feedURL string, t time.Time) error {
+	return s.update(chatID, func(c *fileChat) {
+		if c.PublishedAt == nil {
+			c.PublishedAt = map[string]time.Time{}
+		}
+		c.PublishedAt[feedURL] = t
+	})
+}
+
+// ReadSeenKeys reads the GUIDs or hashes of feedURL feed items published to telegram chat chatID
+// in dedup mode from the file.
+func (s *fileStore) ReadSeenKeys(ctx context.Context, chatID, feedURL, mode string) ([]string, error) {
+	var keys []string
+	err := s.read(chatID, func(c *fileChat) {
+		keys = c.seen(mode)[feedURL]
+	})
+	return keys, err
+}
+
+// WriteSeenKeys writes the GUIDs or hashes of feedURL feed items published to telegram chat chatID
+// in dedup mode to the file.
+func (s *fileStore) WriteSeenKeys(ctx context.Context, chatID, feedURL, mode string, keys []string) error {
+	return s.update(chatID, func(c *fileChat) {
+		c.seen(mode)[feedURL] = keys
+	})
+}
+
+// ReadFeedCache reads the validators of the last feedURL feed response of telegram chat chatID from the file.
+func (s *fileStore) ReadFeedCache(ctx context.Context, chatID, feedURL string) (FeedCache, error) {
+	var cache FeedCache
+	err := s.read(chatID, func(c *fileChat) {
+		cache = c.HTTPCache[feedURL]
+	})
+	return cache, err
+}
+
+// WriteFeedCache writes the validators of the last feedURL feed response of telegram chat chatID to the file.
+func (s *fileStore) WriteFeedCache(ctx context.Context, chatID, feedURL string, cache FeedCache) error {
+	return s.update(chatID, func(c *fileChat) {
+		if c.HTTPCache == nil {
+			c.HTTPCache = map[string]FeedCache{}
+		}
+		c.HTTPCache[feedURL] = cache
+	})
+}
+
+// ReadRevisions reads the last posted revisions of feedURL feed items of telegram chat chatID from the file.
+func (s *fileStore) ReadRevisions(ctx context.Context, chatID, feedURL string) (map[string]ItemRevision, error) {
+	var revisions map[string]ItemRevision
+	err := s.read(chatID, func(c *fileChat) {
+		revisions = c.Revisions[feedURL]
+	})
+	return revisions, err
+}
+
+// WriteRevisions writes the last posted revisions of feedURL feed items of telegram chat chatID to the file.
+func (s *fileStore) WriteRevisions(ctx context.Context, chatID, feedURL string, revisions map[string]ItemRevision) error {
+	return s.update(chatID, func(c *fileChat) {
+		if c.Revisions == nil {
+			c.Revisions = map[string]map[string]ItemRevision{}
+		}
+		c.Revisions[feedURL] = revisions
+	})
+}
+
+// ReadLastRunAt reads the time feedURL feed of telegram chat chatID was last processed from the file.
+func (s *fileStore) ReadLastRunAt(ctx context.Context, chatID, feedURL string) (time.Time, error) {
+	var t time.Time
+	err := s.read(chatID, func(c *fileChat) {
+		t = c.LastRunAt[feedURL]
+	})
+	return t, err
+}
+
+// WriteLastRunAt writes the time feedURL feed of telegram chat chatID was last processed to the file.
+func (s *fileStore) WriteLastRunAt(ctx context.Context, chatID, feedURL string, t time.Time) error {
+	return s.update(chatID, func(c *fileChat) {
+		if c.LastRunAt == nil {
+			c.LastRunAt = map[string]time.Time{}
+		}
+		c.LastRunAt[feedURL] = t
+	})
+}
+
+// ReadPostedLinks reads the times links were posted to telegram chat chatID by any feed from the file.
+func (s *fileStore) ReadPostedLinks(ctx context.Context, chatID string) (map[string]time.Time, error) {
+	var links map[string]time.Time
+	err := s.read(chatID, func(c *fileChat) {
+		links = c.PostedLinks
+	})
+	return links, err
+}
+
+// WritePostedLinks writes the times links were posted to telegram chat chatID to the file.
+func (s *fileStore) WritePostedLinks(ctx context.Context, chatID string, links map[string]time.Time) error {
+	return s.update(chatID, func(c *fileChat) {
+		c.PostedLinks = links
+	})
+}
+
+// Ping reads the file, a file that does not exist yet is not an error.
+func (s *fileStore) Ping(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.load()
+	return err
+}
+
+// PruneCursors deletes the state of all feeds but keepFeedURLs of all telegram chats from the file.
+func (s *fileStore) PruneCursors(ctx context.Context, keepFeedURLs []string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chats, err := s.load()
+	if err != nil {
+		return 0, err
+	}
+
+	keep := feedSet(keepFeedURLs)
+	var n int
+	for _, c := range chats {
+		for feedURL := range c.PublishedAt {
+			if !keep[feedURL] {
+				delete(c.PublishedAt, feedURL)
+				n++
+			}
+		}
+		for _, seen := range []map[string][]string{c.SeenGUIDs, c.SeenHashes} {
+			for feedURL := range seen {
+				if !keep[feedURL] {
+					delete(seen, feedURL)
+					n++
+				}
+			}
+		}
+		for feedURL := range c.HTTPCache {
+			if !keep[feedURL] {
+				delete(c.HTTPCache, feedURL)
+				n++
+			}
+		}
+		for feedURL := range c.Revisions {
+			if !keep[feedURL] {
+				delete(c.Revisions, feedURL)
+				n++
+			}
+		}
+		for feedURL := range c.LastRunAt {
+			if !keep[feedURL] {
+				delete(c.LastRunAt, feedURL)
+				n++
+			}
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	return n, s.save(chats)
+}
+
+// read calls f with the state of telegram chat chatID.
+func (s *fileStore) read(chatID string, f func(c *fileChat)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chats, err := s.load()
+	if err != nil {
+		return err
+	}
+	c := chats[chatID]
+	if c == nil {
+		c = &fileChat{}
+	}
+	f(c)
+
+	return nil
+}
+
+// update calls f to modify the state of telegram chat chatID and saves the file.
+func (s *fileStore) update(chatID string, f func(c *fileChat)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chats, err := s.load()
+	if err != nil {
+		return err
+	}
+	c := chats[chatID]
+	if c == nil {
+		c = &fileChat{}
+		chats[chatID] = c
+	}
+	f(c)
+
+	return s.save(chats)
+}
+
+// load reads the state of all chats from the file, empty if the file does not exist.
+func (s *fileStore) load() (map[string]*fileChat, error) {
+	chats := map[string]*fileChat{}
+
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return chats, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &chats); err != nil {
+		return nil, fmt.Errorf("store file %s: %v", s.path, err)
+	}
+
+	return chats, nil
+}
+
+// save writes the state of all chats to the file. The file is replaced atomically
+// so an interrupted run does not corrupt the state.
+func (s *fileStore) save(chats map[string]*fileChat) error {
+	data, err := json.MarshalIndent(chats, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
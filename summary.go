@@ -0,0 +1,70 @@
+package rss2telegram
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Summary is the summary of a run.
+type Summary struct {
+	// ItemsFetched is the number of items in the retrieved feeds.
+	ItemsFetched int `json:"itemsFetched"`
+	// ItemsSent is the number of items sent to telegram.
+	ItemsSent int `json:"itemsSent"`
+	// ItemsFailed is the number of items failed to send.
+	ItemsFailed int `json:"itemsFailed"`
+	// ItemsFiltered is the number of new items not passed the filters.
+	ItemsFiltered int `json:"itemsFiltered"`
+	// FeedsFailed is the number of feeds failed to process.
+	FeedsFailed int `json:"feedsFailed"`
+	// SuggestedPollInterval is the shortest interval the retrieved feeds declare they are updated at
+	// with <ttl> or sy:updatePeriod, zero if none of them does. Schedulers may poll as often as it,
+	// it is encoded in JSON as nanoseconds.
+	SuggestedPollInterval time.Duration `json:"suggestedPollInterval,omitempty"`
+
+	// firstErr is the first error of the run.
+	firstErr error
+	// itemsLeft is the number of new items left for the next runs, over the limit of a run or not settled yet.
+	itemsLeft int
+}
+
+// itemFailed records a failure to send an item.
+func (s *Summary) itemFailed(err error) {
+	s.ItemsFailed++
+	if s.firstErr == nil {
+		s.firstErr = err
+	}
+}
+
+// feedPolled records the interval a retrieved feed declares it is updated at, zero if it declares none.
+func (s *Summary) feedPolled(interval time.Duration) {
+	if interval > 0 && (s.SuggestedPollInterval == 0 || interval < s.SuggestedPollInterval) {
+		s.SuggestedPollInterval = interval
+	}
+}
+
+// feedFailed records a failure to process a feed.
+func (s *Summary) feedFailed(err error) {
+	s.FeedsFailed++
+	if s.firstErr == nil {
+		s.firstErr = err
+	}
+}
+
+// reportToAdmin posts the summary of failures of the run to telegram chat adminChatID.
+// Nothing is posted if the run had no failures.
+func reportToAdmin(ctx context.Context, bot telegramBot, adminChatID string, s Summary) {
+	if s.firstErr == nil {
+		return
+	}
+
+	// the report is posted as plain text to the admin chat without the feed settings
+	admin := telegramBot{apiBaseURL: bot.apiBaseURL, apiToken: bot.apiToken, client: bot.client, maxAttempts: bot.maxAttempts, dryRun: bot.dryRun}
+	text := fmt.Sprintf("rss2telegram: %d items failed to send, %d feeds failed to process.\n\nFirst error: %v",
+		s.ItemsFailed, s.FeedsFailed, s.firstErr)
+
+	if err := sendMessage(ctx, admin, adminChatID, truncateMessage(text, maxMessageLength, ""), ""); err != nil {
+		logger.Error("reporting to admin chat", "chat_id", adminChatID, "error", err)
+	}
+}
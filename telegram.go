@@ -0,0 +1,364 @@
+package rss2telegram
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const (
+	// maxMessageLength is the maximum length of a telegram message text in characters.
+	maxMessageLength = 4096
+	// maxCaptionLength is the maximum length of a telegram media caption in characters.
+	maxCaptionLength = 1024
+	// defaultAPIBaseURL is the url of the public telegram bot api server.
+	defaultAPIBaseURL = "https://api.telegram.org"
+	// defaultMaxAttempts is the default number of attempts to send a message when rate limited.
+	defaultMaxAttempts = 3
+)
+
+// telegramBot holds the settings of the telegram bot used to post messages.
+type telegramBot struct {
+	// apiBaseURL is the url of telegram bot api server.
+	apiBaseURL string
+	apiToken   string
+	// client is the http client used to call telegram bot api.
+	client *http.Client
+	// maxAttempts is the number of attempts to send a message when rate limited.
+	maxAttempts int
+	// retry is the policy of retrying requests failed with transient errors.
+	retry retryPolicy
+	// limiter paces messages within telegram rate limits, shared by the copies of the bot in a run.
+	// Nil for no limit.
+	limiter *rateLimiter
+	// pool are the bots items are sent with in turn, nil to send with apiToken only.
+	pool *botPool
+	// threadID is the id of the forum topic messages are posted to, empty for normal chats.
+	threadID string
+	// disableWebPagePreview disables link previews in messages.
+	disableWebPagePreview bool
+	// disableNotification posts messages silently.
+	disableNotification bool
+	// dryRun logs messages instead of posting them.
+	dryRun bool
+	// readMoreButton is the text of inline button linking to the item, empty for no button.
+	readMoreButton string
+	// sendEnclosures posts items with a document enclosure as a document.
+	sendEnclosures bool
+	// feedImage is the url of the feed image items without an image are posted as, empty for none.
+	feedImage string
+	// message holds the settings of rendering feed items as messages.
+	message messageOptions
+}
+
+// apiResponse is the response of telegram bot api.
+type apiResponse struct {
+	OK          bool   `json:"ok"`
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+	// Result is the result of the method, e.g. the chat member of getChatMember.
+	Result     json.RawMessage `json:"result"`
+	Parameters struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+// sendToTelegram posts item to telegram chat chatID. Youtube videos are posted as their thumbnails
+// with the text and the video link as a caption. If item has a video, an audio, a document enclosure
+// (if bot.sendEnclosures is set) or an image, it is posted as a video, an audio, a document or a photo
+// with the text as a caption, otherwise the text is split into several messages if it exceeds
+// telegram message length limit. Enclosures telegram can't send are posted as their links.
+// Items are sent by the bots of bot.pool in turn.
+func sendToTelegram(ctx context.Context, bot telegramBot, chatID string, item *gofeed.Item) error {
+	bot = bot.next()
+	text, err := renderMessage(bot.message, item)
+	if err != nil {
+		return err
+	}
+	markup, err := bot.replyMarkup(item)
+	if err != nil {
+		return err
+	}
+
+	if video, thumbnail := youtubeVideo(item); thumbnail != "" {
+		// youtube items have no content, so the caption always links to the video
+		if link := escapeText(bot.message.parseMode, video); !strings.Contains(text, link) {
+			text += "\n\n" + link
+		}
+		caption := truncateMessage(text, maxCaptionLength, bot.message.parseMode)
+		err := sendPhoto(ctx, bot, chatID, thumbnail, caption, markup)
+		if err == nil {
+			return nil
+		}
+		logger.Warn("sendPhoto failed, posting a text message instead", "photo_url", thumbnail, "error", err)
+	} else if video := itemEnclosure(item, "video"); video != nil {
+		if videoTypes[video.Type] && !tooLargeForURL(video) {
+			caption := truncateMessage(text, maxCaptionLength, bot.message.parseMode)
+			err := sendVideo(ctx, bot, chatID, video.URL, caption, markup)
+			if err == nil {
+				return nil
+			}
+			logger.Warn("sendVideo failed, posting the link instead", "video_url", video.URL, "error", err)
+		}
+		// the video can't be sent by telegram, post its link instead
+		text += "\n\n" + escapeText(bot.message.parseMode, video.URL)
+	} else if audio := itemEnclosure(item, "audio"); audio != nil {
+		if !tooLargeForURL(audio) {
+			caption := truncateMessage(text, maxCaptionLength, bot.message.parseMode)
+			err := sendAudio(ctx, bot, chatID, audio.URL, bot.message.title(item), caption, markup)
+			if err == nil {
+				return nil
+			}
+			logger.Warn("sendAudio failed, posting the link instead", "audio_url", audio.URL, "error", err)
+		}
+		// the audio can't be sent by telegram, post its link instead
+		text += "\n\n" + escapeText(bot.message.parseMode, audio.URL)
+	} else if doc := itemDocument(item); bot.sendEnclosures && doc != nil {
+		if documentTypes[doc.Type] && !tooLargeForURL(doc) {
+			caption := truncateMessage(text, maxCaptionLength, bot.message.parseMode)
+			err := sendDocument(ctx, bot, chatID, doc.URL, caption, markup)
+			if err == nil {
+				return nil
+			}
+			logger.Warn("sendDocument failed, posting the link instead", "document_url", doc.URL, "error", err)
+		}
+		// the document can't be sent by telegram, post its link instead
+		text += "\n\n" + escapeText(bot.message.parseMode, doc.URL)
+	} else if photo := orString(itemImage(item), bot.feedImage); photo != "" {
+		caption := truncateMessage(text, maxCaptionLength, bot.message.parseMode)
+		err := sendPhoto(ctx, bot, chatID, photo, caption, markup)
+		if err == nil {
+			return nil
+		}
+		// telegram may fail to fetch the photo, fall back to a text message
+		logger.Warn("sendPhoto failed, posting a text message instead", "photo_url", photo, "error", err)
+	}
+
+	chunks := splitMessage(text, maxMessageLength, bot.message.parseMode)
+	for i, chunk := range chunks {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// the reply markup is attached to the last message only
+		var chunkMarkup string
+		if i == len(chunks)-1 {
+			chunkMarkup = markup
+		}
+		if err := sendMessage(ctx, bot, chatID, chunk, chunkMarkup); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sendMessage posts text to telegram chat chatID using sendMessage method.
+func sendMessage(ctx context.Context, bot telegramBot, chatID, text, markup string) error {
+	params := bot.params(chatID, markup)
+	params.Set("text", text)
+	params.Set("disable_web_page_preview", strconv.FormatBool(bot.disableWebPagePreview))
+	return callMethod(ctx, bot, "sendMessage", params)
+}
+
+// sendPhoto posts photo url with caption to telegram chat chatID using sendPhoto method.
+func sendPhoto(ctx context.Context, bot telegramBot, chatID, photo, caption, markup string) error {
+	params := bot.params(chatID, markup)
+	params.Set("photo", photo)
+	params.Set("caption", caption)
+	return callMethod(ctx, bot, "sendPhoto", params)
+}
+
+// sendAudio posts audio url with title and caption to telegram chat chatID using sendAudio method.
+func sendAudio(ctx context.Context, bot telegramBot, chatID, audio, title, caption, markup string) error {
+	params := bot.params(chatID, markup)
+	params.Set("audio", audio)
+	params.Set("title", title)
+	params.Set("caption", caption)
+	return callMethod(ctx, bot, "sendAudio", params)
+}
+
+// sendVideo posts video url with caption to telegram chat chatID using sendVideo method.
+func sendVideo(ctx context.Context, bot telegramBot, chatID, video, caption, markup string) error {
+	params := bot.params(chatID, markup)
+	params.Set("video", video)
+	params.Set("caption", caption)
+	return callMethod(ctx, bot, "sendVideo", params)
+}
+
+// sendDocument posts document url with caption to telegram chat chatID using sendDocument method.
+func sendDocument(ctx context.Context, bot telegramBot, chatID, document, caption, markup string) error {
+	params := bot.params(chatID, markup)
+	params.Set("document", document)
+	params.Set("caption", caption)
+	return callMethod(ctx, bot, "sendDocument", params)
+}
+
+// params returns the params of sending a message to telegram chat chatID with reply markup
+// common to all send methods.
+func (bot telegramBot) params(chatID, markup string) url.Values {
+	params := url.Values{"chat_id": {chatID}}
+	if bot.message.parseMode != "" && bot.message.parseMode != parseModeNone {
+		params.Set("parse_mode", bot.message.parseMode)
+	}
+	if bot.threadID != "" {
+		params.Set("message_thread_id", bot.threadID)
+	}
+	if bot.disableNotification {
+		params.Set("disable_notification", "true")
+	}
+	if markup != "" {
+		params.Set("reply_markup", markup)
+	}
+	return params
+}
+
+// inlineKeyboardMarkup is the reply markup of telegram inline keyboard.
+type inlineKeyboardMarkup struct {
+	InlineKeyboard [][]inlineKeyboardButton `json:"inline_keyboard"`
+}
+
+// inlineKeyboardButton is a button of telegram inline keyboard.
+type inlineKeyboardButton struct {
+	Text string `json:"text"`
+	URL  string `json:"url"`
+}
+
+// replyMarkup returns JSON-encoded reply markup of item messages, empty if there is none.
+func (bot telegramBot) replyMarkup(item *gofeed.Item) (string, error) {
+	link := bot.message.link(item)
+	if bot.readMoreButton == "" || link == "" {
+		return "", nil
+	}
+
+	data, err := json.Marshal(inlineKeyboardMarkup{
+		InlineKeyboard: [][]inlineKeyboardButton{{{Text: bot.readMoreButton, URL: link}}},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// callMethod calls telegram bot api method with params.
+// Messages are sent no faster than bot.limiter allows.
+// If telegram responds with 429 Too Many Requests, the request is repeated after
+// the delay telegram asked for, up to bot.maxAttempts attempts.
+// Requests failed with network errors or 5xx responses are retried according to bot.retry.
+// In dry run the request is logged instead.
+func callMethod(ctx context.Context, bot telegramBot, method string, params url.Values) error {
+	return callMethodResult(ctx, bot, method, params, nil)
+}
+
+// callMethodResult is callMethod decoding the result of the method into result, unless it is nil.
+func callMethodResult(ctx context.Context, bot telegramBot, method string, params url.Values, result interface{}) error {
+	if bot.dryRun {
+		logger.Info("dry run", "method", method, "params", params)
+		return nil
+	}
+
+	if chatID := params.Get("chat_id"); bot.limiter != nil && strings.HasPrefix(method, "send") && chatID != "" {
+		if err := bot.limiter.wait(ctx, chatID); err != nil {
+			return err
+		}
+	}
+
+	attempts, retries := 1, 0
+	for {
+		retryAfter, err := postMethod(ctx, bot, method, params, result)
+		if err == nil {
+			return nil
+		}
+
+		var delay time.Duration
+		switch {
+		case retryAfter > 0 && attempts < bot.maxAttempts:
+			delay = retryAfter
+			attempts++
+		case isTransient(err) && retries < bot.retry.maxRetries:
+			delay = bot.retry.delay(retries)
+			retries++
+		default:
+			return err
+		}
+
+		logger.Warn("retrying", "method", method, "error", err, "delay", delay)
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// postMethod makes a single request to telegram bot api method with params.
+// Returns the delay to retry after if the request was rate limited.
+// Network errors and 5xx responses are returned as transient errors, other failed responses as apiError.
+// The result of the method is decoded into result, unless it is nil.
+func postMethod(ctx context.Context, bot telegramBot, method string, params url.Values, result interface{}) (time.Duration, error) {
+	apiURL := fmt.Sprintf("%s/bot%s/%s", strings.TrimRight(bot.apiBaseURL, "/"), bot.apiToken, method)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	start := time.Now()
+	resp, err := bot.client.Do(req)
+	telegramRequestDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		if urlErr, ok := err.(*url.Error); ok {
+			// keep the bot token out of logs and reports
+			urlErr.URL = strings.Replace(urlErr.URL, bot.apiToken, "<token>", -1)
+		}
+		return 0, transient(ctx, err)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return 0, transient(ctx, err)
+	}
+
+	if resp.StatusCode != 200 {
+		err := apiError{statusCode: resp.StatusCode, data: data}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			var r apiResponse
+			if json.Unmarshal(data, &r) == nil && r.Parameters.RetryAfter > 0 {
+				return time.Duration(r.Parameters.RetryAfter) * time.Second, err
+			}
+		}
+		if resp.StatusCode >= 500 {
+			return 0, transientError{err}
+		}
+		return 0, err
+	}
+
+	if result != nil {
+		var r apiResponse
+		if err := json.Unmarshal(data, &r); err != nil {
+			return 0, fmt.Errorf("decoding response: %v", err)
+		}
+		if err := json.Unmarshal(r.Result, result); err != nil {
+			return 0, fmt.Errorf("decoding result: %v", err)
+		}
+	}
+
+	return 0, nil
+}
+
+// apiError is the error of a failed response of telegram bot api.
+type apiError struct {
+	statusCode int
+	data       []byte
+}
+
+func (e apiError) Error() string {
+	return fmt.Sprintf("status code: %d, data: %s", e.statusCode, e.data)
+}
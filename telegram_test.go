@@ -0,0 +1,174 @@
+package rss2telegram
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// testBot returns telegramBot of bot api at apiURL rendering messages in parseMode with the default template.
+func testBot(t *testing.T, apiURL, parseMode string) telegramBot {
+	tmpl, err := parseMessageTemplate("", parseMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return telegramBot{
+		apiBaseURL:  apiURL,
+		apiToken:    "token",
+		client:      http.DefaultClient,
+		maxAttempts: 1,
+		message:     messageOptions{parseMode: parseMode, template: tmpl},
+	}
+}
+
+func TestSendToTelegramEnclosures(t *testing.T) {
+	tests := []struct {
+		enclosure gofeed.Enclosure
+		method    string
+		param     string
+	}{
+		{gofeed.Enclosure{URL: "https://example.com/1.mp4", Type: "video/mp4"}, "sendVideo", "video"},
+		{gofeed.Enclosure{URL: "https://example.com/1.mp3", Type: "audio/mpeg"}, "sendAudio", "audio"},
+		{gofeed.Enclosure{URL: "https://example.com/1.pdf", Type: "application/pdf"}, "sendDocument", "document"},
+		{gofeed.Enclosure{URL: "https://example.com/1.png", Type: "image/png"}, "sendPhoto", "photo"},
+	}
+	for _, tt := range tests {
+		for _, sendEnclosures := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/%t", tt.enclosure.Type, sendEnclosures), func(t *testing.T) {
+				var methods []string
+				var params []map[string]string
+				tg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					r.ParseForm()
+					p := map[string]string{}
+					for k := range r.PostForm {
+						p[k] = r.PostForm.Get(k)
+					}
+					methods = append(methods, path.Base(r.URL.Path))
+					params = append(params, p)
+					w.Write([]byte(`{"ok":true}`))
+				}))
+				defer tg.Close()
+				bot := testBot(t, tg.URL, parseModeMarkdown)
+				bot.sendEnclosures = sendEnclosures
+				enclosure := tt.enclosure
+				item := &gofeed.Item{Title: "Title", Content: "<p>Body</p>", Enclosures: []*gofeed.Enclosure{&enclosure}}
+
+				if err := sendToTelegram(context.Background(), bot, "1", item); err != nil {
+					t.Fatal(err)
+				}
+				if len(methods) != 1 {
+					t.Fatalf("sent %v, want 1 message", methods)
+				}
+				if !sendEnclosures && tt.method == "sendDocument" {
+					// document enclosures are ignored unless SEND_ENCLOSURES is set
+					if methods[0] != "sendMessage" || strings.Contains(params[0]["text"], "example.com") {
+						t.Errorf("sent %s %v, want the text message only", methods[0], params[0])
+					}
+					return
+				}
+				if methods[0] != tt.method || params[0][tt.param] != enclosure.URL {
+					t.Errorf("sent %s %v, want %s of %s", methods[0], params[0], tt.method, enclosure.URL)
+				}
+			})
+		}
+	}
+}
+
+func TestCallMethodRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		requests int
+		wantErr  bool
+	}{
+		{"rate limited once", []int{http.StatusTooManyRequests, http.StatusOK}, 2, false},
+		{"rate limited always", []int{http.StatusTooManyRequests}, 2, true},
+		{"server error once", []int{http.StatusBadGateway, http.StatusOK}, 2, false},
+		{"server error always", []int{http.StatusInternalServerError}, 3, true},
+		{"bad request", []int{http.StatusBadRequest, http.StatusOK}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+			tg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				status := tt.statuses[min(requests, len(tt.statuses))-1]
+				w.WriteHeader(status)
+				fmt.Fprintf(w, `{"ok":%t,"error_code":%d,"description":"status","parameters":{"retry_after":1}}`, status == http.StatusOK, status)
+			}))
+			defer tg.Close()
+			bot := testBot(t, tg.URL, parseModeMarkdown)
+			bot.maxAttempts = 2
+			bot.retry = retryPolicy{maxRetries: 2, baseDelay: time.Millisecond}
+
+			err := sendMessage(context.Background(), bot, "1", "text", "")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("sendMessage() error = %v, want error %v", err, tt.wantErr)
+			}
+			// 4xx responses other than 429 are not retried
+			if requests != tt.requests {
+				t.Errorf("sent %d requests, want %d", requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestReplyMarkupReadMoreButton(t *testing.T) {
+	tests := []struct {
+		name, button, link string
+		want               string
+	}{
+		{"button", "Read more", `https://example.com/a?x=1&y="2"`, `{"inline_keyboard":[[{"text":"Read more","url":"https://example.com/a?x=1\u0026y=\"2\""}]]}`},
+		{"custom text", "Читать «далее»", "https://example.com/b", `{"inline_keyboard":[[{"text":"Читать «далее»","url":"https://example.com/b"}]]}`},
+		{"without link", "Read more", "", ""},
+		{"without button", "", "https://example.com/c", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := telegramBot{readMoreButton: tt.button}
+			item := &gofeed.Item{Title: "Title", Link: tt.link, Content: "<p>Body</p>"}
+
+			markup, err := bot.replyMarkup(item)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == "" {
+				if markup != "" {
+					t.Errorf("replyMarkup() = %q, want none", markup)
+				}
+				return
+			}
+			if markup != tt.want {
+				t.Errorf("replyMarkup() = %s, want %s", markup, tt.want)
+			}
+			var decoded inlineKeyboardMarkup
+			if err := json.Unmarshal([]byte(markup), &decoded); err != nil {
+				t.Fatal(err)
+			}
+			if b := decoded.InlineKeyboard[0][0]; b.Text != tt.button || b.URL != tt.link {
+				t.Errorf("button = %+v, want %q linking to %q", b, tt.button, tt.link)
+			}
+		})
+	}
+}
+
+func TestReadMoreButtonConfig(t *testing.T) {
+	cfg := Config{FeedURLs: []string{"https://example.com/feed"}, BotAPIToken: "token", ChatIDs: []string{"1"}}
+	cfg.ReadMoreButton = true
+
+	bot, _, err := cfg.settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bot.readMoreButton != defaultReadMoreButtonText {
+		t.Errorf("readMoreButton = %q, want %q", bot.readMoreButton, defaultReadMoreButtonText)
+	}
+}
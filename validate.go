@@ -0,0 +1,76 @@
+package rss2telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// botUser is the user of a telegram bot returned by getMe.
+type botUser struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+// chatMember is the membership of a user in a telegram chat returned by getChatMember.
+type chatMember struct {
+	// Status is "creator", "administrator", "member", "restricted", "left" or "kicked".
+	Status string `json:"status"`
+}
+
+// validateBot checks that the token of bot is valid with getMe and that the bot is a member
+// of each of chatIDs with getChatMember, so a misconfigured bot fails with a descriptive error
+// before any item is processed instead of each item failing to be sent.
+func validateBot(ctx context.Context, bot telegramBot, chatIDs []string) error {
+	// the methods post nothing, so they are called in dry run as well
+	bot.dryRun = false
+
+	var me botUser
+	if err := callMethodResult(ctx, bot, "getMe", url.Values{}, &me); err != nil {
+		if statusCode(err) == http.StatusUnauthorized {
+			return errors.New("telegram: bot token invalid")
+		}
+		return fmt.Errorf("telegram getMe: %v", err)
+	}
+
+	for _, chatID := range chatIDs {
+		var member chatMember
+		params := url.Values{"chat_id": {chatID}, "user_id": {strconv.FormatInt(me.ID, 10)}}
+		err := callMethodResult(ctx, bot, "getChatMember", params, &member)
+		switch {
+		case statusCode(err) == http.StatusBadRequest:
+			return fmt.Errorf("telegram: chat %s not found: %v", chatID, err)
+		case statusCode(err) == http.StatusForbidden || member.Status == "left" || member.Status == "kicked":
+			return fmt.Errorf("telegram: bot @%s is not a member of chat %s", me.Username, chatID)
+		case err != nil:
+			return fmt.Errorf("telegram getChatMember %s: %v", chatID, err)
+		}
+	}
+
+	return nil
+}
+
+// statusCode returns the status code of err of telegram bot api response, zero for other errors.
+func statusCode(err error) int {
+	var e apiError
+	if errors.As(err, &e) {
+		return e.statusCode
+	}
+	return 0
+}
+
+// routeChats returns the unique chats of routes in order.
+func routeChats(routes []feedRoute) []string {
+	var chats []string
+	seen := map[string]bool{}
+	for _, r := range routes {
+		if !seen[r.chatID] {
+			seen[r.chatID] = true
+			chats = append(chats, r.chatID)
+		}
+	}
+	return chats
+}
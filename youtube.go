@@ -0,0 +1,44 @@
+package rss2telegram
+
+import (
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+)
+
+// youtubeWatchURL is the url of a youtube video page without the video id.
+const youtubeWatchURL = "https://www.youtube.com/watch?v="
+
+// youtubeVideo returns the url and the thumbnail url of the video of item of a youtube channel
+// or playlist feed (youtube.com/feeds/videos.xml), which keeps them in yt and media extensions
+// instead of the content. Returns empty strings if item is not a youtube video.
+func youtubeVideo(item *gofeed.Item) (video, thumbnail string) {
+	videoID := extensionValue(item.Extensions, "yt", "videoId")
+	if videoID == "" {
+		return "", ""
+	}
+
+	video = item.Link
+	if video == "" {
+		video = youtubeWatchURL + videoID
+	}
+
+	for _, group := range item.Extensions["media"]["group"] {
+		for _, t := range group.Children["thumbnail"] {
+			if t.Attrs["url"] != "" {
+				return video, t.Attrs["url"]
+			}
+		}
+	}
+
+	return video, ""
+}
+
+// extensionValue returns the value of the first name element of prefix namespace in extensions.
+func extensionValue(extensions ext.Extensions, prefix, name string) string {
+	for _, e := range extensions[prefix][name] {
+		if e.Value != "" {
+			return e.Value
+		}
+	}
+	return ""
+}